@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/rsmohamad/comp4321/database"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	indexFile := flag.String("index", "index.db", "-index=<index file>")
+	defaultOut := fmt.Sprintf("index-%s.db", time.Now().Format("20060102-150405"))
+	out := flag.String("out", defaultOut, "-out=<snapshot file>, - for standard output")
+	flag.Parse()
+
+	// Read-only, so the server can keep serving from the same file
+	viewer, err := database.LoadViewer(*indexFile)
+	if err != nil {
+		log.Fatal("Index file not found: ", *indexFile)
+	}
+	defer viewer.Close()
+
+	if *out == "-" {
+		_, err = viewer.Snapshot(os.Stdout)
+	} else {
+		err = viewer.SnapshotToFile(*out)
+	}
+	if err != nil {
+		log.Fatal("Snapshot failed: ", err)
+	}
+
+	if *out != "-" {
+		fmt.Println("Saved snapshot of", *indexFile, "to", *out)
+	}
+}
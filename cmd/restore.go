@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/rsmohamad/comp4321/database"
+	"io"
+	"log"
+	"os"
+)
+
+func main() {
+	indexFile := flag.String("index", "index.db", "-index=<index file>")
+	from := flag.String("from", "", "-from=<snapshot file>, - for standard input")
+	flag.Parse()
+
+	var snapshot io.Reader = os.Stdin
+	if *from == "" {
+		log.Fatal("No snapshot given, use -from=<snapshot file>")
+	} else if *from != "-" {
+		file, err := os.Open(*from)
+		if err != nil {
+			log.Fatal("Snapshot file not found: ", *from)
+		}
+		defer file.Close()
+		snapshot = file
+	}
+
+	if err := database.Restore(snapshot, *indexFile); err != nil {
+		log.Fatal("Restore failed: ", err)
+	}
+	fmt.Println("Restored", *indexFile, "from", *from)
+}
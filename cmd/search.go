@@ -2,12 +2,40 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"github.com/rsmohamad/comp4321/retrieval"
+	"log"
+	"math"
 	"os"
 )
 
 func main() {
+	opts := retrieval.DefaultOptions()
+	model := flag.String("model", string(retrieval.VSpace), "-model=<vspace|bm25|bm25f>")
+	flag.Float64Var(&opts.TitleBoost, "title", retrieval.DefaultTitleBoost, "-title=<title boost>")
+	flag.Float64Var(&opts.ContentWeight, "content", 1, "-content=<content score weight>")
+	flag.Float64Var(&opts.PageRankWeight, "pagerank", 0, "-pagerank=<PageRank weight>")
+	flag.BoolVar(&opts.LogLinear, "loglinear", false, "-loglinear")
+	flag.Parse()
+	opts.Model = retrieval.RankingModel(*model)
+	switch opts.Model {
+	case retrieval.VSpace, retrieval.BM25, retrieval.BM25F:
+	default:
+		log.Fatal("Invalid ranking model: ", *model)
+	}
+
+	// Weights are finite and not negative, as in the search API
+	weights := map[string]float64{"title": opts.TitleBoost, "content": opts.ContentWeight, "pagerank": opts.PageRankWeight}
+	for name, weight := range weights {
+		if !(weight >= 0) || math.IsInf(weight, 0) {
+			log.Fatalf("Invalid -%s weight: %v", name, weight)
+		}
+	}
+	if opts.Model == retrieval.BM25F && opts.TitleBoost <= 0 {
+		log.Fatal("-title must be positive with -model=bm25f")
+	}
+
 	for {
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Enter search term: ")
@@ -16,7 +44,7 @@ func main() {
 		se := retrieval.NewSearchEngine("index.db")
 		defer se.Close()
 
-		results := se.RetrieveVSpace(query)
+		results, _ := se.RetrieveVSpace(query, opts)
 		for _, doc := range results {
 			fmt.Println(doc.Title, doc.Score)
 		}
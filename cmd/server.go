@@ -1,14 +1,43 @@
 package main
 
 import (
+	"flag"
 	"github.com/rsmohamad/comp4321/controllers"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 )
 
 func main() {
+	indexFile := flag.String("index", "index.db", "-index=<index file>")
+	buildDir := flag.String("builds", "", "-builds=<directory of new index files>")
+	flag.Parse()
+	if *buildDir == "" {
+		*buildDir = filepath.Dir(*indexFile)
+	}
+
+	if err := controllers.LoadIndex(*indexFile); err != nil {
+		log.Fatal("Cannot load index ", *indexFile, ": ", err)
+	}
+
+	// Reload the index file on SIGHUP, e.g. after ./restore
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := controllers.SwapIndex(""); err != nil {
+				log.Println("Reload failed:", err)
+			}
+		}
+	}()
+
 	controllers.LoadHome()
 	controllers.LoadSearch()
 	controllers.LoadHistory()
+	controllers.LoadApi()
+	controllers.LoadAdmin(os.Getenv("ADMIN_TOKEN"), *buildDir)
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
@@ -4,27 +4,144 @@ import (
 	"flag"
 	"fmt"
 	"github.com/rsmohamad/comp4321/database"
+	"github.com/rsmohamad/comp4321/models"
 	"github.com/rsmohamad/comp4321/webcrawler"
+	"io"
+	"log"
+	"os"
+	"strings"
 	"time"
 )
 
-func main() {
-	index, _ := database.LoadIndexer("index.db")
-	defer index.Close()
+// Flag that can be given more than once
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
 
-	start := flag.String("start", "http://www.cse.ust.hk/", "-start=<starting url>")
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	var starts listFlag
+	flag.Var(&starts, "start", "-start=<starting url>, repeatable")
+	seedsFile := flag.String("seeds", "", "-seeds=<file with one starting url per line>")
 	numPages := flag.Int("pages", 300, "-pages=<number of pages>")
 	aggressive := flag.Bool("a", false, "-a")
+	recrawl := flag.Bool("recrawl", false, "-recrawl")
+	resume := flag.Bool("resume", false, "-resume")
+	damping := flag.Float64("damping", database.DefaultDamping, "-damping=<PageRank damping factor>")
+	indexFile := flag.String("index", "index.db", "-index=<index file>")
+	logFile := flag.String("log", "", "-log=<file for the JSON lines crawl log>")
+	summaryFile := flag.String("summary", "", "-summary=<file for the JSON crawl summary>")
+
+	// Scope rules are added to the ones of the scope file
+	scopeFile := flag.String("scope", "", "-scope=<scope file>")
+	var allow, deny, includePrefix, excludePrefix, include, exclude listFlag
+	flag.Var(&allow, "allow", "-allow=<host>, repeatable")
+	flag.Var(&deny, "deny", "-deny=<host>, repeatable")
+	flag.Var(&includePrefix, "include-prefix", "-include-prefix=<url prefix>, repeatable")
+	flag.Var(&excludePrefix, "exclude-prefix", "-exclude-prefix=<url prefix>, repeatable")
+	flag.Var(&include, "include", "-include=<url regex>, repeatable")
+	flag.Var(&exclude, "exclude", "-exclude=<url regex>, repeatable")
+	maxDepth := flag.Int("depth", 0, "-depth=<max links from the seed>")
+	perHost := flag.Int("per-host", 0, "-per-host=<max pages per host>")
 	flag.Parse()
 
+	// Ranks diverge or turn negative outside [0, 1)
+	if !(*damping >= 0 && *damping < 1) {
+		log.Fatal("Invalid damping factor, must be at least 0 and below 1: ", *damping)
+	}
+
+	seeds := []string(starts)
+	if *seedsFile != "" {
+		fromFile, err := webcrawler.LoadSeeds(*seedsFile)
+		if err != nil {
+			log.Fatal("Invalid seeds file: ", err)
+		}
+		seeds = append(seeds, fromFile...)
+	}
+
+	index, err := database.LoadIndexer(*indexFile)
+	if err != nil {
+		log.Fatal("Cannot open index: ", err)
+	}
+	defer index.Close()
+
+	// A resumed crawl keeps its seeds
+	if len(seeds) == 0 && (!*resume || len(index.GetSeeds()) == 0) {
+		seeds = []string{"http://www.cse.ust.hk/"}
+	}
+
+	scope := webcrawler.DefaultScope()
+	if *scopeFile != "" {
+		var err error
+		scope, err = webcrawler.LoadScope(*scopeFile)
+		if err != nil {
+			log.Fatal("Invalid scope file: ", err)
+		}
+	}
+	scope.AllowHosts = append(scope.AllowHosts, allow...)
+	scope.DenyHosts = append(scope.DenyHosts, deny...)
+	scope.IncludePrefixes = append(scope.IncludePrefixes, includePrefix...)
+	scope.ExcludePrefixes = append(scope.ExcludePrefixes, excludePrefix...)
+	scope.Include = append(scope.Include, include...)
+	scope.Exclude = append(scope.Exclude, exclude...)
+	if *maxDepth > 0 {
+		scope.MaxDepth = *maxDepth
+	}
+	if *perHost > 0 {
+		scope.MaxPagesPerHost = *perHost
+	}
+	if err := scope.Compile(); err != nil {
+		log.Fatal("Invalid scope: ", err)
+	}
+
+	var logWriter io.Writer
+	if *logFile != "" {
+		file, err := os.Create(*logFile)
+		if err != nil {
+			log.Fatal("Cannot create crawl log: ", err)
+		}
+		defer file.Close()
+		logWriter = file
+	}
+	crawlLog := webcrawler.NewCrawlLog(logWriter)
+
 	startCrawl := time.Now()
-	obtained := webcrawler.Crawl(*start, *numPages, index, true, *aggressive)
+	obtained := webcrawler.Crawl(seeds, *numPages, index, scope, crawlLog, *aggressive, *recrawl, *resume)
 	elapsed := time.Since(startCrawl)
 	fmt.Printf("Indexing %d pages took %s\n", len(obtained), elapsed)
+
+	summary := crawlLog.Summary()
+	fmt.Printf("Crawl: %d urls, %d bytes, %.2f pages/s, mean latency %.0fms\n",
+		summary.Urls, summary.Bytes, summary.PagesPerSecond, summary.MeanLatencyMs)
+	if *summaryFile != "" {
+		file, err := os.Create(*summaryFile)
+		if err != nil {
+			log.Fatal("Cannot create crawl summary: ", err)
+		}
+		if err = crawlLog.WriteSummary(file); err != nil {
+			log.Fatal("Cannot write crawl summary: ", err)
+		}
+		if err = file.Close(); err != nil {
+			log.Fatal("Cannot write crawl summary: ", err)
+		}
+	}
+	counts := index.CountCrawlStates()
+	fmt.Printf("Frontier: %d queued, %d fetched, %d failed, %d skipped\n",
+		counts[models.Queued]+counts[models.InFlight], counts[models.Fetched], counts[models.Failed], counts[models.Skipped])
 	fmt.Println("Updating term weights...")
 	index.UpdateTermWeights()
 	fmt.Println("Updating adj list...")
 	index.UpdateAdjList()
 	fmt.Println("Updating page rank...")
-	index.UpdatePageRank()
+	iterations, residual, err := index.UpdatePageRankWith(*damping, database.DefaultTolerance)
+	if err != nil {
+		log.Fatal("Cannot update page rank: ", err)
+	}
+	fmt.Printf("PageRank took %d iterations, residual %g\n", iterations, residual)
 }
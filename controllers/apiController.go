@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/rsmohamad/comp4321/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func apiSearchHandler(w http.ResponseWriter, r *http.Request) {
+	viewModel := models.ResultView{}
+	queries := buildQuery(r.URL.Query())
+	pagerank := r.URL.Query().Get("pagerank")
+	opts := getOptions(r)
+	viewModel.Page, viewModel.PageSize, viewModel.Model = opts.Page, opts.Size, string(opts.Model)
+	viewModel.Field = r.URL.Query().Get("field")
+	viewModel.Site = r.URL.Query().Get("site")
+
+	startSearch := time.Now()
+	index, release := acquireIndex()
+	defer release()
+	viewModel.Query = r.URL.Query().Get("keywords")
+	viewModel.Results, viewModel.TotalResults = retrieveResults(index.se, queries, pagerank == "on", opts)
+	viewModel.SetPageLinks(r.URL)
+	elapsed := time.Since(startSearch)
+
+	log.Println(fmt.Sprintf("[%s] [API] [%s] [%s]", r.RemoteAddr, queries, elapsed))
+	writeJson(w, http.StatusOK, viewModel)
+}
+
+func apiNestedHandler(w http.ResponseWriter, r *http.Request) {
+	viewModel := models.ResultView{}
+	haystack := r.URL.Query().Get("haystack")
+	needle := r.URL.Query().Get("needle")
+	opts := getOptions(r)
+	viewModel.Page, viewModel.PageSize, viewModel.Model = opts.Page, opts.Size, string(opts.Model)
+
+	startSearch := time.Now()
+	index, release := acquireIndex()
+	defer release()
+	viewModel.Query = fmt.Sprintf("<%s> INSIDE <%s>", needle, haystack)
+	viewModel.Results, viewModel.TotalResults = index.se.RetrieveNested(haystack, needle, opts)
+	viewModel.SetPageLinks(r.URL)
+	elapsed := time.Since(startSearch)
+
+	log.Println(fmt.Sprintf("[%s] [API] [%s] [%s]", r.RemoteAddr, viewModel.Query, elapsed))
+	writeJson(w, http.StatusOK, viewModel)
+}
+
+func apiDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/document/")
+	pageId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, apiError{"invalid document id: " + idStr})
+		return
+	}
+
+	index, release := acquireIndex()
+	defer release()
+	docView := index.se.RetrieveDocument(pageId)
+
+	if docView == nil {
+		writeJson(w, http.StatusNotFound, apiError{"document not found: " + idStr})
+		return
+	}
+	writeJson(w, http.StatusOK, docView)
+}
+
+func LoadApi() {
+	http.HandleFunc("/api/search", apiSearchHandler)
+	http.HandleFunc("/api/search/nested", apiNestedHandler)
+	http.HandleFunc("/api/document/", apiDocumentHandler)
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/rsmohamad/comp4321/database"
+	"github.com/rsmohamad/comp4321/retrieval"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Index served to all requests, with the caches built from it.
+// A swap replaces the whole struct, so the caches are dropped with the old index.
+type servedIndex struct {
+	se *retrieval.SEngine
+
+	keywordsOnce sync.Once
+	keywords     map[string][]string
+	prefixes     []string
+}
+
+// File of the served index, set by LoadIndex
+var indexFile string
+
+// Requests hold the read lock while they use the index, so a swap waits for them
+var served struct {
+	sync.RWMutex
+	index *servedIndex
+}
+
+// Only one swap runs at a time
+var swapLock sync.Mutex
+
+// Returns the served index and the function to call once the request is done with it
+func acquireIndex() (*servedIndex, func()) {
+	served.RLock()
+	return served.index, served.RUnlock
+}
+
+// Returns the keywords of the index by first letter, and the sorted first letters
+func (s *servedIndex) getKeywords() (map[string][]string, []string) {
+	s.keywordsOnce.Do(func() {
+		s.keywords = make(map[string][]string)
+		s.prefixes = make([]string, 0)
+
+		for _, word := range s.se.GetKeywords() {
+			firstLetter := string(word[0])
+			if s.keywords[firstLetter] == nil {
+				s.keywords[firstLetter] = make([]string, 0)
+				s.prefixes = append(s.prefixes, firstLetter)
+			}
+			s.keywords[firstLetter] = append(s.keywords[firstLetter], word)
+		}
+		sort.Strings(s.prefixes)
+	})
+	return s.keywords, s.prefixes
+}
+
+// Open the index file to serve
+func LoadIndex(filename string) error {
+	se, err := retrieval.LoadSearchEngine(filename)
+	if err != nil {
+		return err
+	}
+
+	indexFile = filename
+	served.index = &servedIndex{se: se}
+	return nil
+}
+
+// Serve a new index without stopping the server.
+// If filename is given, that index is first moved over the served index file,
+// see database.Replace. Otherwise the served index file is loaded again, e.g.
+// after ./restore replaced it. Requests in progress finish on the old index,
+// which is then closed.
+func SwapIndex(filename string) error {
+	swapLock.Lock()
+	defer swapLock.Unlock()
+
+	if filename != "" && filename != indexFile {
+		if err := database.Replace(filename, indexFile); err != nil {
+			return err
+		}
+	}
+
+	se, err := retrieval.LoadSearchEngine(indexFile)
+	if err != nil {
+		return err
+	}
+
+	served.Lock()
+	old := served.index
+	served.index = &servedIndex{se: se}
+	served.Unlock()
+
+	old.se.Close()
+	log.Println("Swapped in index", indexFile)
+	return nil
+}
+
+// Token the admin requests must send, and the directory the new indexes are taken from
+var adminToken, buildDir string
+
+// Returns true if the request sends the admin token.
+// The token is sent in a header, so browsers cannot send it cross-site without CORS.
+func isAdmin(r *http.Request) bool {
+	token := r.Header.Get("X-Admin-Token")
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// Returns the path of the named index in the build directory.
+// Returns an error if the name is a path, so only indexes in the build directory can be swapped in.
+func buildPath(name string) (string, error) {
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", errors.New("index must be a file name in the build directory: " + name)
+	}
+	return filepath.Join(buildDir, name), nil
+}
+
+// POST /admin/reload[?index=<file>] swaps in a new index, see SwapIndex.
+// The index is a file name in the build directory. Requires the admin token.
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		writeJson(w, http.StatusForbidden, apiError{"reload requires the admin token"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJson(w, http.StatusMethodNotAllowed, apiError{"reload requires POST"})
+		return
+	}
+
+	filename := ""
+	if name := r.URL.Query().Get("index"); name != "" {
+		path, err := buildPath(name)
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, apiError{err.Error()})
+			return
+		}
+		filename = path
+	}
+
+	if err := SwapIndex(filename); err != nil {
+		writeJson(w, http.StatusInternalServerError, apiError{err.Error()})
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]string{"index": indexFile})
+}
+
+// Serve /admin/reload to requests sending the token, swapping in indexes from dir.
+// Without a token the endpoint is not served.
+func LoadAdmin(token, dir string) {
+	if token == "" {
+		log.Println("No admin token, /admin/reload is disabled")
+		return
+	}
+	adminToken, buildDir = token, dir
+	http.HandleFunc("/admin/reload", reloadHandler)
+}
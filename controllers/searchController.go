@@ -7,61 +7,106 @@ import (
 	"github.com/rsmohamad/comp4321/retrieval"
 	"html/template"
 	"log"
+	"math"
 	"net/http"
-	"sort"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var resultTemplate *template.Template
 var keywordsTemplate *template.Template
-var prefixes []string
-var keywords map[string][]string
 
 type KeywordsView struct {
 	Prefixes []string
 	Keywords map[string][]string
 }
 
-func loadKeywords() (map[string][]string, []string) {
-	v, _ := database.LoadViewer("index.db")
-	defer v.Close()
+func keywordsHandler(w http.ResponseWriter, r *http.Request) {
+	index, release := acquireIndex()
+	defer release()
 
-	k := v.GetKeywords()
-	prefixes := make([]string, 0)
-	keywords := make(map[string][]string)
+	keywords, prefixes := index.getKeywords()
+	keywordsTemplate.Execute(w, KeywordsView{prefixes, keywords})
+}
 
-	for _, word := range k {
-		firstLetter := string(word[0])
-		if keywords[firstLetter] == nil {
-			keywords[firstLetter] = make([]string, 0)
-			prefixes = append(prefixes, firstLetter)
-		}
-		keywords[firstLetter] = append(keywords[firstLetter], word)
+// Run the query, blending in PageRank if requested.
+// Queries with boolean operators are evaluated as boolean queries.
+func retrieveResults(se *retrieval.SEngine, queries string, pagerank bool, opts retrieval.Options) ([]*models.DocumentView, int) {
+	if pagerank && opts.PageRankWeight == 0 {
+		opts.PageRankWeight = retrieval.DefaultPageRankWeight
+	}
+	if retrieval.IsBooleanQuery(queries) {
+		return se.RetrieveBoolean(queries, opts)
 	}
+	return se.RetrievePhrase(queries, opts)
+}
 
-	sort.Strings(prefixes)
-	return keywords, prefixes
+// Combine the keywords with the field and site options of the search form
+func buildQuery(values url.Values) string {
+	query := values.Get("keywords")
+	field := values.Get("field")
+	if strings.TrimSpace(query) != "" && (field == "title" || field == "body") {
+		query = field + ":(" + query + ")"
+	}
+
+	if site := strings.TrimSpace(values.Get("site")); site != "" {
+		query += " site:" + site
+	}
+	return query
 }
 
-func keywordsHandler(w http.ResponseWriter, r *http.Request) {
-	if keywords == nil {
-		keywords, prefixes = loadKeywords()
+// Read the page number, page size, ranking model and score weights from the query string
+func getOptions(r *http.Request) retrieval.Options {
+	opts := retrieval.DefaultOptions()
+	values := r.URL.Query()
+
+	if page, err := strconv.Atoi(values.Get("page")); err == nil && page > 0 {
+		opts.Page = page
+	}
+	if size, err := strconv.Atoi(values.Get("size")); err == nil && size > 0 {
+		opts.Size = int(math.Min(float64(size), retrieval.MaxPageSize))
 	}
 
-	keywordsTemplate.Execute(w, KeywordsView{prefixes, keywords})
+	switch model := retrieval.RankingModel(values.Get("model")); model {
+	case retrieval.BM25, retrieval.BM25F:
+		opts.Model = model
+	}
+
+	// Weights of the final score
+	weights := map[string]*float64{
+		"titleBoost":     &opts.TitleBoost,
+		"contentWeight":  &opts.ContentWeight,
+		"pagerankWeight": &opts.PageRankWeight,
+	}
+	for key, weight := range weights {
+		if val, err := strconv.ParseFloat(values.Get(key), 64); err == nil && val >= 0 && !math.IsInf(val, 0) {
+			*weight = val
+		}
+	}
+	// BM25F weighs the title by titleBoost, without it the title would be ignored
+	if opts.Model == retrieval.BM25F && opts.TitleBoost <= 0 {
+		opts.TitleBoost = retrieval.DefaultTitleBoost
+	}
+	opts.LogLinear = values.Get("combine") == "loglinear"
+	opts.KeepDuplicates = values.Get("duplicates") == "show"
+	return opts
 }
 
 func nestedHandler(w http.ResponseWriter, r *http.Request) {
 	viewModel := models.ResultView{}
 	haystack := r.URL.Query().Get("haystack")
 	needle := r.URL.Query().Get("needle")
+	opts := getOptions(r)
+	viewModel.Page, viewModel.PageSize, viewModel.Model = opts.Page, opts.Size, string(opts.Model)
 
 	startSearch := time.Now()
-	se := retrieval.NewSearchEngine("index.db")
+	index, release := acquireIndex()
+	defer release()
 	viewModel.Query = fmt.Sprintf("<%s> INSIDE <%s>", needle, haystack)
-	viewModel.Results = se.RetrieveNested(haystack, needle)
-	viewModel.TotalResults = len(viewModel.Results)
-	se.Close()
+	viewModel.Results, viewModel.TotalResults = index.se.RetrieveNested(haystack, needle, opts)
+	viewModel.SetPageLinks(r.URL)
 	elapsed := time.Since(startSearch)
 
 	log.Println(fmt.Sprintf("[%s] [%s] [%s]", r.RemoteAddr, viewModel.Query, elapsed))
@@ -70,26 +115,23 @@ func nestedHandler(w http.ResponseWriter, r *http.Request) {
 
 func searchHandler(w http.ResponseWriter, r *http.Request) {
 	viewModel := models.ResultView{}
-	queries := r.URL.Query().Get("keywords")
+	queries := buildQuery(r.URL.Query())
 	pagerank := r.URL.Query().Get("pagerank")
-	fmt.Println(pagerank)
+	opts := getOptions(r)
+	viewModel.Page, viewModel.PageSize, viewModel.Model = opts.Page, opts.Size, string(opts.Model)
+	viewModel.Field = r.URL.Query().Get("field")
+	viewModel.Site = r.URL.Query().Get("site")
 
 	userId := database.GetCookieInstance().GetCookieId(r)
 	database.GetCookieInstance().SetCookieResponse(userId, w)
 	database.GetCookieInstance().AddQuery(userId, queries)
 
 	startSearch := time.Now()
-	se := retrieval.NewSearchEngine("index.db")
-	viewModel.Query = queries
-
-	if pagerank == "on" {
-		viewModel.Results = se.RetrievePageRank(queries)
-	} else {
-		viewModel.Results = se.RetrievePhrase(queries)
-	}
-
-	viewModel.TotalResults = len(viewModel.Results)
-	se.Close()
+	index, release := acquireIndex()
+	defer release()
+	viewModel.Query = r.URL.Query().Get("keywords")
+	viewModel.Results, viewModel.TotalResults = retrieveResults(index.se, queries, pagerank == "on", opts)
+	viewModel.SetPageLinks(r.URL)
 	elapsed := time.Since(startSearch)
 
 	log.Println(fmt.Sprintf("[%s] [%s] [%s]", r.RemoteAddr, queries, elapsed))
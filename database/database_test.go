@@ -1,9 +1,16 @@
 package database
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/rsmohamad/comp4321/models"
+	"math"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
 )
 
 func generateWords(num int) map[string]models.Word {
@@ -180,3 +187,615 @@ func TestTermWeights(t *testing.T) {
 
 	viewer.Close()
 }
+
+func TestGetDocument(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+
+	docs := generateDocuments(10)
+	for _, doc := range docs {
+		doc.ETag = fmt.Sprintf("\"%s\"", doc.Title)
+		indexer.UpdateOrAddPage(doc)
+	}
+
+	for _, doc := range docs {
+		stored := indexer.GetDocument(doc.Uri)
+		if stored == nil || stored.Uri != doc.Uri || stored.ETag != doc.ETag {
+			t.Fail()
+		}
+	}
+
+	if indexer.GetDocument("http://10.com/") != nil {
+		t.Fail()
+	}
+
+	indexer.Close()
+}
+
+func TestUpdatePage(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+
+	docs := generateDocuments(10)
+	for _, doc := range docs {
+		indexer.UpdateOrAddPage(doc)
+	}
+	indexer.FlushInverted()
+
+	// Replace the words of page 5 with the words of page 3
+	updated := generateDocuments(10)[5]
+	updated.Words = generateWords(3)
+	updated.MaxTf = models.CountMaxTf(updated.Words)
+	indexer.UpdateOrAddPage(updated)
+	indexer.FlushInverted()
+	indexer.Close()
+
+	viewer, _ := LoadViewer("index_test.db")
+	if pos := viewer.GetPositionIndices(6, "5", false); len(pos) != 0 {
+		t.Log("stale posting for 5:", pos)
+		t.Fail()
+	}
+	if pages := viewer.GetContainingPages("3"); len(pages) != 2 {
+		t.Log("missing posting for 3:", pages)
+		t.Fail()
+	}
+	viewer.Close()
+}
+
+func TestDeletePage(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+
+	docs := generateDocuments(10)
+	for _, doc := range docs {
+		indexer.UpdateOrAddPage(doc)
+	}
+	indexer.FlushInverted()
+	indexer.UpdateTermWeights()
+	indexer.UpdateAdjList()
+	indexer.UpdatePageRank()
+
+	if !indexer.DeletePage("http://4.com/") {
+		t.Fail()
+	}
+	if indexer.DeletePage("http://4.com/") {
+		t.Fail()
+	}
+	indexer.Close()
+
+	viewer, _ := LoadViewer("index_test.db")
+	defer viewer.Close()
+
+	if viewer.ContainsUrl("http://4.com/") {
+		t.Fail()
+	}
+	if pages := viewer.GetContainingPages("4"); len(pages) != 0 {
+		t.Log("postings not deleted:", pages)
+		t.Fail()
+	}
+	if viewer.GetDocument(5) != nil || viewer.GetPageRank(5) != 0 || viewer.GetMagnitude(5, false) != 0 {
+		t.Fail()
+	}
+	if len(viewer.GetParentLinks(5)) != 0 {
+		t.Fail()
+	}
+	for _, parent := range viewer.GetParentLinks(1) {
+		if parent == "http://4.com/" {
+			t.Fail()
+		}
+	}
+}
+
+func TestDocumentLengths(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+
+	docs := generateDocuments(10)
+	for _, doc := range docs {
+		indexer.UpdateOrAddPage(doc)
+	}
+
+	indexer.FlushInverted()
+	indexer.UpdateTermWeights()
+	indexer.Close()
+
+	viewer, _ := LoadViewer("index_test.db")
+	defer viewer.Close()
+
+	for i := 0; i < 10; i++ {
+		if viewer.GetLength(uint64(i+1), false) != i || viewer.GetLength(uint64(i+1), true) != 1 {
+			t.Fail()
+		}
+		if i > 0 && viewer.GetTf(uint64(i+1), fmt.Sprint(i), false) != i {
+			t.Fail()
+		}
+	}
+
+	if viewer.GetAverageLength(false) != 4.5 || viewer.GetAverageLength(true) != 1 {
+		t.Log(viewer.GetAverageLength(false), viewer.GetAverageLength(true))
+		t.Fail()
+	}
+
+	if viewer.GetNumPages() != 10 {
+		t.Fail()
+	}
+}
+
+func insertGraph(indexer *Indexer, links map[string][]string) {
+	for uri, children := range links {
+		doc := &models.Document{Uri: uri, Title: uri, Links: children}
+		doc.Titles = models.CountTfandIdx([]string{uri})
+		indexer.UpdateOrAddPage(doc)
+	}
+	indexer.FlushInverted()
+	indexer.UpdateAdjList()
+}
+
+func TestPageRankSmallGraph(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+
+	insertGraph(indexer, map[string][]string{
+		"a": {"b", "c"},
+		"b": {"c"},
+		"c": {"a"},
+	})
+	iterations, residual := indexer.UpdatePageRank()
+	indexer.Close()
+
+	if iterations == 0 || iterations >= MaxPageRankIterations || residual >= DefaultTolerance {
+		t.Log(iterations, residual)
+		t.Fail()
+	}
+
+	viewer, _ := LoadViewer("index_test.db")
+	defer viewer.Close()
+
+	expected := map[string]float64{"a": 0.3878, "b": 0.2148, "c": 0.3974}
+	for uri, pr := range expected {
+		actual := viewer.GetPageRank(byteToUint64(viewer.urlToId(uri)))
+		if math.Abs(actual-pr) > 1e-3 {
+			t.Log(uri, actual)
+			t.Fail()
+		}
+	}
+}
+
+func TestPageRankDangling(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+
+	insertGraph(indexer, map[string][]string{
+		"a": {"b", "c"},
+		"b": {},
+		"c": {"http://not.indexed/"},
+	})
+	if _, _, err := indexer.UpdatePageRankWith(0.5, DefaultTolerance); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range [][2]float64{{1, DefaultTolerance}, {-0.1, DefaultTolerance}, {math.NaN(), DefaultTolerance}, {0.5, 0}} {
+		if _, _, err := indexer.UpdatePageRankWith(invalid[0], invalid[1]); err == nil {
+			t.Error("Expected an error for damping and tolerance", invalid)
+		}
+	}
+	indexer.Close()
+
+	viewer, _ := LoadViewer("index_test.db")
+	defer viewer.Close()
+
+	sum := 0.0
+	for _, id := range viewer.GetPageIds() {
+		sum += viewer.GetPageRank(id)
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Log(sum)
+		t.Fail()
+	}
+
+	a := viewer.GetPageRank(byteToUint64(viewer.urlToId("a")))
+	b := viewer.GetPageRank(byteToUint64(viewer.urlToId("b")))
+	if b <= a {
+		t.Fail()
+	}
+}
+
+func TestFrontier(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+	defer indexer.Close()
+
+	added := indexer.EnqueueUrls([]string{"http://a.com/", "http://b.com/", "http://a.com/"}, 0)
+	if len(added) != 2 {
+		t.Fatal("Expected 2 new urls, got", added)
+	}
+	if len(indexer.EnqueueUrls([]string{"http://b.com/"}, 1)) != 0 {
+		t.Error("Expected seen url to be skipped")
+	}
+
+	urls := indexer.DequeueUrls(1)
+	if len(urls) != 1 || urls[0] != "http://a.com/" {
+		t.Fatal("Expected the first queued url, got", urls)
+	}
+	indexer.EnqueueUrls([]string{"http://c.com/"}, 2)
+	if state, _ := indexer.GetCrawlState(urls[0]); state.Status != models.InFlight {
+		t.Error("Expected in-flight url, got", state.Status)
+	}
+
+	// Interrupted crawl puts in-flight urls back at the end of the queue
+	if indexer.RequeueUnfinished() != 1 {
+		t.Error("Expected 1 requeued url")
+	}
+	urls = indexer.DequeueUrls(5)
+	if len(urls) != 3 || urls[0] != "http://b.com/" || urls[1] != "http://c.com/" || urls[2] != "http://a.com/" {
+		t.Fatal("Wrong queue order", urls)
+	}
+	if state, _ := indexer.GetCrawlState("http://c.com/"); state.Depth != 2 {
+		t.Error("Expected depth to be kept, got", state.Depth)
+	}
+
+	indexer.SetCrawlState("http://a.com/", models.Fetched, "")
+	indexer.SetCrawlState("http://b.com/", models.Failed, "HTTP 500")
+	if state, found := indexer.GetCrawlState("http://b.com/"); !found || state.Reason != "HTTP 500" {
+		t.Error("Expected failure reason, got", state)
+	}
+	counts := indexer.CountCrawlStates()
+	if counts[models.Fetched] != 1 || counts[models.Failed] != 1 || counts[models.InFlight] != 1 {
+		t.Error("Wrong state counts", counts)
+	}
+
+	// Urls skipped by a crawl limit are queued again too
+	indexer.SetCrawlState("http://c.com/", models.Skipped, "page limit of host reached")
+	if indexer.RequeueUnfinished() != 1 {
+		t.Error("Expected the skipped url to be requeued")
+	}
+	if urls = indexer.DequeueUrls(5); len(urls) != 1 || urls[0] != "http://c.com/" {
+		t.Error("Expected the skipped url in the queue, got", urls)
+	}
+
+	// Seeds are kept with the frontier
+	indexer.EnqueueSeeds([]string{"http://a.com/", "http://seed.com/"})
+	if seeds := indexer.GetSeeds(); len(seeds) != 2 || seeds[0] != "http://a.com/" || seeds[1] != "http://seed.com/" {
+		t.Error("Wrong seeds", seeds)
+	}
+	if state, _ := indexer.GetCrawlState("http://a.com/"); state.Status != models.Fetched {
+		t.Error("Expected the seed to keep its state, got", state.Status)
+	}
+
+	indexer.ClearFrontier()
+	if _, found := indexer.GetCrawlState("http://a.com/"); found {
+		t.Error("Expected empty frontier")
+	}
+
+	// Seeds first, then higher priority, then newest first, then in order.
+	// Unknown modification times rank between recent and old ones.
+	now := time.Now().Unix()
+	indexer.Enqueue([]models.QueuedUrl{
+		{Url: "http://low.com/", Priority: 0.1},
+		{Url: "http://old.com/", Priority: 0.8, Lastmod: 100},
+		{Url: "http://first.com/", Priority: 0.5},
+		{Url: "http://new.com/", Priority: 0.8, Lastmod: 200},
+		{Url: "http://stale.com/", Priority: 0.5, Lastmod: 100},
+		{Url: "http://second.com/", Priority: 0.5},
+		{Url: "http://fresh.com/", Priority: 0.5, Lastmod: now},
+	})
+	indexer.EnqueueSeeds([]string{"http://seed.com/"})
+	urls = indexer.DequeueUrls(8)
+	expected := []string{"http://seed.com/", "http://new.com/", "http://old.com/", "http://fresh.com/",
+		"http://first.com/", "http://second.com/", "http://stale.com/", "http://low.com/"}
+	for j := range expected {
+		if j >= len(urls) || urls[j] != expected[j] {
+			t.Fatal("Wrong priority order", urls)
+		}
+	}
+}
+
+func TestRedirectTarget(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+	defer indexer.Close()
+
+	indexer.EnqueueUrls([]string{"http://a.com/", "http://www.a.com/", "http://b.com/"}, 0)
+	if urls := indexer.DequeueUrls(1); len(urls) != 1 || urls[0] != "http://a.com/" {
+		t.Fatal("Expected the first queued url, got", urls)
+	}
+
+	// A queued redirect target is taken out of the queue
+	indexer.SetCrawlState("http://a.com/", models.Fetched, "")
+	indexer.SetRedirectTarget("http://www.a.com/", "http://a.com/")
+	if urls := indexer.DequeueUrls(5); len(urls) != 1 || urls[0] != "http://b.com/" {
+		t.Error("Expected the redirect target to be dequeued, got", urls)
+	}
+	if state, _ := indexer.GetCrawlState("http://www.a.com/"); state.Status != models.Fetched || state.RedirectedFrom != "http://a.com/" {
+		t.Error("Wrong state of the redirect target", state)
+	}
+
+	// Pages fetched themselves are kept as they are
+	indexer.SetCrawlState("http://b.com/", models.Fetched, "")
+	indexer.SetRedirectTarget("http://b.com/", "http://a.com/")
+	if state, _ := indexer.GetCrawlState("http://b.com/"); state.RedirectedFrom != "" {
+		t.Error("Expected a fetched page to keep its state, got", state)
+	}
+
+	// Requeued urls can be taken out of the queue again
+	indexer.EnqueueUrls([]string{"http://c.com/"}, 0)
+	indexer.DequeueUrls(1)
+	indexer.SetCrawlState("http://c.com/", models.Skipped, "page limit of host reached")
+	indexer.RequeueUnfinished()
+	indexer.SetRedirectTarget("http://c.com/", "http://b.com/")
+	if urls := indexer.DequeueUrls(5); len(urls) != 0 {
+		t.Error("Expected an empty queue, got", urls)
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+
+	// Pages 2 and 3 differ from page 1 in one bit, page 4 in many,
+	// page 5 in three bits but in four from pages 2 and 3
+	fingerprints := []uint64{0xF0F0F0F0F0F0F0F0, 0xF0F0F0F0F0F0F0F1, 0xF0F0F0F0F0F0F0F2, 0x0F0F0F0F0F0F0F0F, 0x80F0F0F0F0F0F0F0}
+	for i, fingerprint := range fingerprints {
+		doc := &models.Document{
+			Uri:         fmt.Sprintf("http://%d.com/", i),
+			Title:       "title",
+			Words:       models.CountTfandIdx([]string{"word"}),
+			Titles:      models.CountTfandIdx([]string{"title"}),
+			Fingerprint: fingerprint,
+		}
+		duplicateOf := indexer.UpdateOrAddPage(doc)
+		expected := ""
+		if i == 1 || i == 2 || i == 4 {
+			expected = "http://0.com/"
+		}
+		if duplicateOf != expected {
+			t.Errorf("Expected page %d to be a duplicate of %q, got %q", i+1, expected, duplicateOf)
+		}
+	}
+	indexer.FlushInverted()
+	indexer.Close()
+
+	viewer, _ := LoadViewer("index_test.db")
+	reps := viewer.GetRepresentatives([]uint64{1, 2, 3, 4, 5})
+	if len(reps) != 3 || reps[2] != 1 || reps[3] != 1 || reps[5] != 1 {
+		t.Error("Expected pages 2, 3 and 5 to be duplicates of page 1, got", reps)
+	}
+	viewer.Close()
+
+	// Deleting the representative clusters the other pages again, without page 5
+	indexer, _ = LoadIndexer("index_test.db")
+	indexer.DeletePage("http://0.com/")
+	indexer.Close()
+
+	viewer, _ = LoadViewer("index_test.db")
+	defer viewer.Close()
+	if reps = viewer.GetRepresentatives([]uint64{2, 3, 4, 5}); len(reps) != 1 || reps[3] != 2 {
+		t.Error("Expected only page 3 to be a duplicate of page 2, got", reps)
+	}
+}
+
+func TestMigratePostings(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+
+	docs := generateDocuments(5)
+	for _, doc := range docs {
+		indexer.UpdateOrAddPage(doc)
+	}
+	indexer.FlushInverted()
+
+	// Rewrite the postings of "4" in the legacy format
+	wordId := indexer.getOrCreateWordId("4")
+	indexer.db.Update(func(tx *bolt.Tx) error {
+		inverted := tx.Bucket(intToByte(InvertedTable))
+		inverted.Delete(wordId)
+		docs, _ := inverted.CreateBucket(wordId)
+		docs.Put(uint64ToByte(5), []byte("0,1,2,3"))
+		return nil
+	})
+	indexer.Close()
+
+	// Viewers read the legacy format
+	viewer, _ := LoadViewer("index_test.db")
+	if pos := viewer.GetPositionIndices(5, "4", false); len(pos) != 4 {
+		t.Log("legacy positions:", pos)
+		t.Fail()
+	}
+	viewer.Close()
+
+	indexer, _ = LoadIndexer("index_test.db")
+	if migrated := migratePostings(indexer.db); migrated != 0 {
+		t.Log("migrated again:", migrated)
+		t.Fail()
+	}
+	indexer.Close()
+
+	viewer, _ = LoadViewer("index_test.db")
+	if pos := viewer.GetPositionIndices(5, "4", false); len(pos) != 4 || pos[3] != 3 {
+		t.Log("migrated positions:", pos)
+		t.Fail()
+	}
+	if pages := viewer.GetContainingPages("3"); len(pages) != 1 || pages[0] != 4 {
+		t.Log("pages of 3:", pages)
+		t.Fail()
+	}
+	viewer.Close()
+}
+
+func TestQueryIndex(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+
+	docs := generateDocuments(10)
+	docs[4].Words = generateWords(3)
+	for _, doc := range docs {
+		indexer.UpdateOrAddPage(doc)
+	}
+
+	indexer.FlushInverted()
+	indexer.UpdateTermWeights()
+	indexer.Close()
+
+	viewer, _ := LoadViewer("index_test.db")
+	index := viewer.GetQueryIndex([]string{"3", "unknown", "3"}, []uint64{4, 5})
+
+	if index.NumPages != 10 || len(index.Body["unknown"]) != 0 {
+		t.Log("index", index)
+		t.Fail()
+	}
+	if body := index.Body["3"]; len(body) != 2 || body[0].PageId != 4 || body[1].PageId != 5 || body[0].Tf != 3 {
+		t.Log("body postings", body)
+		t.Fail()
+	}
+	for _, p := range index.Body["3"] {
+		if p.Weight == 0 || p.Weight != viewer.GetTfIdf(p.PageId, "3", false) {
+			t.Log("weight", p)
+			t.Fail()
+		}
+	}
+	if title := index.Title["3"]; len(title) != 1 || title[0].PageId != 4 {
+		t.Log("title postings", title)
+		t.Fail()
+	}
+	if stats := index.Pages[5]; stats.Length != 3 || stats.Magnitude != viewer.GetMagnitude(5, false) {
+		t.Log("stats", stats)
+		t.Fail()
+	}
+	viewer.Close()
+}
+
+func TestHostIndex(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+	for _, uri := range []string{"http://cse.ust.hk/a", "http://UST.hk/", "http://hkust.hk/", "http://ust.hk.com/"} {
+		doc := generateDocuments(1)[0]
+		doc.Uri = uri
+		indexer.UpdateOrAddPage(doc)
+	}
+	indexer.DeletePage("http://hkust.hk/")
+
+	// Indexes written before the host index are migrated
+	indexer.db.Update(func(tx *bolt.Tx) error {
+		tx.DeleteBucket(intToByte(HostIndex))
+		tx.CreateBucket(intToByte(HostIndex))
+		return nil
+	})
+	if migrated := migrateHosts(indexer.db); migrated != 3 {
+		t.Error("Expected 3 migrated pages, got", migrated)
+	}
+	indexer.Close()
+
+	viewer, _ := LoadViewer("index_test.db")
+	defer viewer.Close()
+	if ids, indexed := viewer.GetPageIdsByHost("ust.hk"); !indexed || len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Error("Wrong pages of ust.hk", ids)
+	}
+	if ids, _ := viewer.GetPageIdsByHost("hkust.hk"); len(ids) != 0 {
+		t.Error("Expected the deleted page to be removed, got", ids)
+	}
+}
+
+func TestCanonicaliseUrls(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+	defer indexer.Close()
+
+	for _, uri := range []string{"http://A.com/", "http://a.com/", "http://B.com/"} {
+		doc := generateDocuments(1)[0]
+		doc.Uri = uri
+		doc.Links = []string{"http://B.com/"}
+		indexer.UpdateOrAddPage(doc)
+	}
+	indexer.EnqueueUrls([]string{"http://C.com/", "http://c.com/"}, 1)
+
+	canonical := strings.ToLower
+	if rekeyed, removed := indexer.CanonicaliseUrls(canonical); rekeyed != 1 || removed != 1 {
+		t.Error("Expected 1 re-keyed and 1 removed url, got", rekeyed, removed)
+	}
+	if rekeyed, removed := indexer.CanonicaliseUrls(canonical); rekeyed+removed != 0 {
+		t.Error("Expected urls to be re-keyed once, got", rekeyed, removed)
+	}
+
+	if !indexer.ContainsUrl("http://b.com/") || indexer.ContainsUrl("http://A.com/") || !indexer.ContainsUrl("http://a.com/") {
+		t.Error("Wrong urls after re-keying")
+	}
+	if doc := indexer.GetDocument("http://b.com/"); doc == nil || doc.Uri != "http://b.com/" || doc.Links[0] != "http://b.com/" {
+		t.Error("Expected the document to be re-keyed, got", doc)
+	}
+	if urls := indexer.DequeueUrls(5); len(urls) != 1 || urls[0] != "http://c.com/" {
+		t.Error("Expected one canonical queued url, got", urls)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	indexer, _ := LoadIndexer("index_test.db")
+	indexer.DropAll()
+	for _, doc := range generateDocuments(5) {
+		indexer.UpdateOrAddPage(doc)
+	}
+	indexer.FlushInverted()
+	indexer.Close()
+
+	// Snapshots are taken while the index is open for reading
+	viewer, _ := LoadViewer("index_test.db")
+	var snapshot bytes.Buffer
+	if _, err := viewer.Snapshot(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := viewer.SnapshotToFile("snapshot_test.db"); err != nil {
+		t.Fatal(err)
+	}
+	viewer.Close()
+	defer os.Remove("snapshot_test.db")
+	defer os.Remove("restore_test.db")
+
+	if err := Verify("snapshot_test.db"); err != nil {
+		t.Error("snapshot file:", err)
+	}
+	data := snapshot.Bytes()
+	if err := Restore(bytes.NewReader(data), "restore_test.db"); err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := LoadViewer("restore_test.db")
+	if restored.GetNumPages() != 5 || len(restored.GetContainingPages("3")) != 1 {
+		t.Error("restored", restored.GetNumPages(), "pages")
+	}
+	restored.Close()
+
+	// A broken snapshot leaves the index as it was
+	if err := Restore(bytes.NewReader([]byte("not an index")), "restore_test.db"); err == nil {
+		t.Error("restored a broken snapshot")
+	}
+	if err := Verify("restore_test.db"); err != nil {
+		t.Error("index after failed restore:", err)
+	}
+
+	// So does a snapshot with the type of a page cleared
+	corrupted := append([]byte(nil), data...)
+	flags := 4*os.Getpagesize() + 8
+	corrupted[flags], corrupted[flags+1] = 0, 0
+	if err := Restore(bytes.NewReader(corrupted), "restore_test.db"); err == nil {
+		t.Error("restored a corrupted snapshot")
+	}
+
+	// The index cannot be restored while it is being written
+	indexer, _ = LoadIndexer("restore_test.db")
+	if err := Restore(bytes.NewReader(data), "restore_test.db"); err == nil {
+		t.Error("restored an index open for writing")
+	}
+	indexer.Close()
+
+	// Replace moves a new index over the old one
+	if err := Replace("missing_test.db", "restore_test.db"); err == nil {
+		t.Error("replaced with a missing index")
+	}
+	if _, err := os.Stat("missing_test.db"); err == nil {
+		os.Remove("missing_test.db")
+		t.Error("verifying created the missing index")
+	}
+	if err := Replace("snapshot_test.db", "restore_test.db"); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat("snapshot_test.db"); err == nil {
+		t.Error("replace left the new index in place")
+	}
+}
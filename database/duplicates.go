@@ -0,0 +1,159 @@
+package database
+
+import (
+	"bytes"
+
+	"github.com/boltdb/bolt"
+	"github.com/rsmohamad/comp4321/models"
+)
+
+// Pages whose fingerprints differ in at most this many bits are near duplicates
+const NearDuplicateDistance = 3
+
+// Fingerprints are split into bands of 16 bits, indexed in FingerprintBands.
+// With 4 bands, near duplicates share at least one band.
+const fingerprintBands = 4
+
+// Near duplicates are clustered in the Duplicates table, which maps a page
+// to the representative of its cluster. Representatives have no entry.
+// ClusterMembers has a key of the representative followed by the page for each such entry,
+// so that the pages of a cluster are the keys starting with its representative.
+
+func bandKey(band int, fingerprint uint64) []byte {
+	shift := uint(band * 16)
+	return []byte{byte(band), byte(fingerprint >> (shift + 8)), byte(fingerprint >> shift)}
+}
+
+func memberKey(representative, pageId []byte) []byte {
+	return append(append([]byte(nil), representative...), pageId...)
+}
+
+// Remove the page from the cluster it is a member of, if any
+func leaveCluster(tx *bolt.Tx, pageId []byte) {
+	duplicates := tx.Bucket(intToByte(Duplicates))
+	if rep := duplicates.Get(pageId); rep != nil {
+		tx.Bucket(intToByte(ClusterMembers)).Delete(memberKey(rep, pageId))
+		duplicates.Delete(pageId)
+	}
+}
+
+// Returns the members of the cluster of a representative, in ascending order
+func clusterMembers(tx *bolt.Tx, representative []byte) (members [][]byte) {
+	c := tx.Bucket(intToByte(ClusterMembers)).Cursor()
+	for k, _ := c.Seek(representative); k != nil && bytes.HasPrefix(k, representative); k, _ = c.Next() {
+		members = append(members, append([]byte(nil), k[len(representative):]...))
+	}
+	return
+}
+
+// Remove the fingerprint of a page from the fingerprint and band tables.
+// Returns the fingerprint, which is 0 if the page has none.
+func unindexFingerprint(tx *bolt.Tx, pageId []byte) (fingerprint uint64) {
+	fingerprints := tx.Bucket(intToByte(Fingerprint))
+	bands := tx.Bucket(intToByte(FingerprintBands))
+
+	res := fingerprints.Get(pageId)
+	if res == nil {
+		return 0
+	}
+	fingerprint = byteToUint64(res)
+	for band := 0; band < fingerprintBands; band++ {
+		if pages := bands.Bucket(bandKey(band, fingerprint)); pages != nil {
+			pages.Delete(pageId)
+		}
+	}
+	fingerprints.Delete(pageId)
+	return
+}
+
+// Remove the fingerprint of a page and take it out of its cluster.
+// If the page is a representative, the other pages of its cluster are clustered
+// again without it, in ascending order as if they were added anew.
+func (i *Indexer) removeFingerprint(tx *bolt.Tx, pageId []byte) {
+	unindexFingerprint(tx, pageId)
+	leaveCluster(tx, pageId)
+
+	members := clusterMembers(tx, pageId)
+	memberFingerprints := make([]uint64, len(members))
+	for j, member := range members {
+		leaveCluster(tx, member)
+		memberFingerprints[j] = unindexFingerprint(tx, member)
+	}
+	for j, member := range members {
+		addFingerprint(tx, member, memberFingerprints[j])
+	}
+}
+
+// Store the fingerprint of a page and put it in the cluster of its near duplicates.
+// Returns the representative of the cluster, which is 0 if the page has no near duplicates.
+func addFingerprint(tx *bolt.Tx, pageId []byte, fingerprint uint64) (representative uint64) {
+	if fingerprint == 0 {
+		return 0
+	}
+
+	fingerprints := tx.Bucket(intToByte(Fingerprint))
+	bands := tx.Bucket(intToByte(FingerprintBands))
+	duplicates := tx.Bucket(intToByte(Duplicates))
+
+	// Join the cluster with the lowest representative among the near duplicates
+	for band := 0; band < fingerprintBands; band++ {
+		pages := bands.Bucket(bandKey(band, fingerprint))
+		if pages == nil {
+			continue
+		}
+		pages.ForEach(func(candidate, _ []byte) error {
+			if models.HammingDistance(fingerprint, byteToUint64(fingerprints.Get(candidate))) > NearDuplicateDistance {
+				return nil
+			}
+			rep := byteToUint64(candidate)
+			if res := duplicates.Get(candidate); res != nil {
+				rep = byteToUint64(res)
+			}
+			if representative == 0 || rep < representative {
+				representative = rep
+			}
+			return nil
+		})
+	}
+	if representative != 0 {
+		duplicates.Put(pageId, uint64ToByte(representative))
+		tx.Bucket(intToByte(ClusterMembers)).Put(memberKey(uint64ToByte(representative), pageId), []byte{})
+	}
+
+	fingerprints.Put(pageId, uint64ToByte(fingerprint))
+	for band := 0; band < fingerprintBands; band++ {
+		pages, _ := bands.CreateBucketIfNotExists(bandKey(band, fingerprint))
+		pages.Put(pageId, []byte{})
+	}
+	return
+}
+
+// Store the fingerprint of a page and put it in the cluster of its near duplicates.
+// Returns the representative of the cluster, which is 0 if the page has no near duplicates.
+func (i *Indexer) updateFingerprint(pageId []byte, fingerprint uint64) (representative uint64) {
+	i.db.Update(func(tx *bolt.Tx) error {
+		i.removeFingerprint(tx, pageId)
+		representative = addFingerprint(tx, pageId, fingerprint)
+		return nil
+	})
+	return
+}
+
+// Index the cluster members of indexes written before the ClusterMembers table.
+// Returns the number of pages indexed.
+func migrateClusters(db *bolt.DB) (migrated int) {
+	db.Update(func(tx *bolt.Tx) error {
+		members := tx.Bucket(intToByte(ClusterMembers))
+		if k, _ := members.Cursor().First(); k != nil {
+			return nil
+		}
+
+		tx.Bucket(intToByte(Duplicates)).ForEach(func(pageId, rep []byte) error {
+			members.Put(memberKey(rep, pageId), []byte{})
+			migrated++
+			return nil
+		})
+		return nil
+	})
+	return
+}
@@ -2,10 +2,14 @@ package database
 
 import (
 	"bytes"
+	"compress/flate"
 	"encoding/binary"
 	"encoding/gob"
 	"github.com/rsmohamad/comp4321/models"
+	"io/ioutil"
 	"math"
+	"strconv"
+	"strings"
 )
 
 func uint64ToByte(v uint64) []byte {
@@ -70,3 +74,239 @@ func byteToDoc(arr []byte) *models.Document {
 	decoder.Decode(&rv)
 	return &rv
 }
+
+func crawlStateToByte(state models.CrawlState) []byte {
+	var byteBuffer bytes.Buffer
+	encoder := gob.NewEncoder(&byteBuffer)
+	encoder.Encode(state)
+	return byteBuffer.Bytes()
+}
+
+func byteToCrawlState(arr []byte) models.CrawlState {
+	var byteBuffer bytes.Buffer
+	byteBuffer.Write(arr)
+
+	decoder := gob.NewDecoder(&byteBuffer)
+	var rv models.CrawlState
+	decoder.Decode(&rv)
+	return rv
+}
+
+func textToByte(text string) []byte {
+	var byteBuffer bytes.Buffer
+	writer, _ := flate.NewWriter(&byteBuffer, flate.DefaultCompression)
+	writer.Write([]byte(text))
+	writer.Close()
+	return byteBuffer.Bytes()
+}
+
+func byteToText(arr []byte) string {
+	reader := flate.NewReader(bytes.NewReader(arr))
+	defer reader.Close()
+	text, _ := ioutil.ReadAll(reader)
+	return string(text)
+}
+
+// Versions of the posting list encoding.
+// The first byte of an encoded posting list is its version.
+const (
+	// Bucket per word, mapping each page to its positions as comma separated numbers
+	postingsLegacy = iota
+
+	// Posting count, then the delta of each page ID followed by its position count and position deltas, as varints
+	postingsDelta
+
+	// Same as postingsDelta, with the term weight of each page after its page ID delta
+	postingsWeighted
+
+	postingsVersion = postingsWeighted
+)
+
+// Positions of a word in a page.
+// Weight is the tf-idf weight set by UpdateTermWeights.
+type posting struct {
+	pageId    uint64
+	tf        int
+	weight    float64
+	positions []int
+}
+
+// Encode postings sorted by page ID with positions in ascending order
+func postingsToByte(postings []posting) []byte {
+	return encodePostings(postingsHeader(len(postings)), postings, 0)
+}
+
+// Returns the version and posting count that encoded postings start with
+func postingsHeader(count int) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(count))
+	return append([]byte{postingsVersion}, buf[:n]...)
+}
+
+// Append the encoded postings to rv.
+// Page IDs are encoded as deltas from prevId, the last page ID before them.
+func encodePostings(rv []byte, postings []posting, prevId uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(buf, v)
+		rv = append(rv, buf[:n]...)
+	}
+
+	for _, p := range postings {
+		putUvarint(p.pageId - prevId)
+		prevId = p.pageId
+		rv = append(rv, float64ToByte(p.weight)...)
+		putUvarint(uint64(len(p.positions)))
+		prevPos := 0
+		for _, pos := range p.positions {
+			putUvarint(uint64(pos - prevPos))
+			prevPos = pos
+		}
+	}
+	return rv
+}
+
+func byteToPostings(arr []byte) []posting {
+	return decodePostings(arr, true)
+}
+
+// Decode postings of any version after the legacy one.
+// Positions are skipped unless withPositions is set, but tf is always decoded.
+func decodePostings(arr []byte, withPositions bool) []posting {
+	if len(arr) == 0 || arr[0] < postingsDelta || arr[0] > postingsVersion {
+		return nil
+	}
+
+	version := arr[0]
+	arr = arr[1:]
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(arr)
+		if n <= 0 {
+			arr = nil
+			return 0
+		}
+		arr = arr[n:]
+		return v
+	}
+
+	// Every posting takes at least a byte, which bounds the counts of corrupt lists
+	count := uvarint()
+	rv := make([]posting, 0, minLength(count, arr))
+	prevId := uint64(0)
+	for i := uint64(0); i < count && len(arr) > 0; i++ {
+		p := posting{pageId: prevId + uvarint()}
+		prevId = p.pageId
+		if version >= postingsWeighted && len(arr) >= 8 {
+			p.weight = byteToFloat64(arr[:8])
+			arr = arr[8:]
+		}
+
+		tf := uvarint()
+		p.tf = minLength(tf, arr)
+		if withPositions {
+			p.positions = make([]int, 0, p.tf)
+		}
+		prevPos := 0
+		for j := 0; j < p.tf && len(arr) > 0; j++ {
+			prevPos += int(uvarint())
+			if withPositions {
+				p.positions = append(p.positions, prevPos)
+			}
+		}
+		rv = append(rv, p)
+	}
+	return rv
+}
+
+// Returns count, or the length of arr if it is smaller
+func minLength(count uint64, arr []byte) int {
+	if count > uint64(len(arr)) {
+		return len(arr)
+	}
+	return int(count)
+}
+
+// Returns the postings encoded in arr followed by the given ones, which must have
+// page IDs above the last one in arr. Only the posting count of arr is decoded.
+// Returns nil if arr is not in the current encoding.
+func appendPostings(arr []byte, postings []posting) []byte {
+	if len(arr) == 0 || arr[0] != postingsVersion {
+		return nil
+	}
+	count, n := binary.Uvarint(arr[1:])
+	if n <= 0 {
+		return nil
+	}
+
+	rv := append(postingsHeader(int(count)+len(postings)), arr[1+n:]...)
+	return encodePostings(rv, postings, lastPageId(arr))
+}
+
+// Returns the last page ID of postings in the current encoding, skipping over the rest
+func lastPageId(arr []byte) uint64 {
+	if len(arr) == 0 || arr[0] != postingsVersion {
+		return 0
+	}
+
+	arr = arr[1:]
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(arr)
+		if n <= 0 {
+			arr = nil
+			return 0
+		}
+		arr = arr[n:]
+		return v
+	}
+
+	count := uvarint()
+	pageId := uint64(0)
+	for i := uint64(0); i < count && len(arr) > 0; i++ {
+		pageId += uvarint()
+		if len(arr) < 8 {
+			break
+		}
+		arr = arr[8:]
+		for tf := uvarint(); tf > 0 && len(arr) > 0; tf-- {
+			uvarint()
+		}
+	}
+	return pageId
+}
+
+// Returns the number of postings without decoding them
+func postingsCount(arr []byte) int {
+	if len(arr) == 0 || arr[0] < postingsDelta || arr[0] > postingsVersion {
+		return 0
+	}
+	count, _ := binary.Uvarint(arr[1:])
+	return int(count)
+}
+
+func termBoundToByte(bound TermBound) []byte {
+	rv := float64ToByte(bound.Cosine)
+	rv = append(rv, uint64ToByte(uint64(bound.MaxTf))...)
+	return append(rv, uint64ToByte(uint64(bound.MinLength))...)
+}
+
+func byteToTermBound(arr []byte) TermBound {
+	if len(arr) < 24 {
+		return TermBound{}
+	}
+	return TermBound{
+		Cosine:    byteToFloat64(arr[:8]),
+		MaxTf:     int(byteToUint64(arr[8:16])),
+		MinLength: int(byteToUint64(arr[16:24])),
+	}
+}
+
+// Decode the positions of a legacy posting
+func legacyToPositions(arr []byte) []int {
+	rv := make([]int, 0)
+	for _, indexStr := range strings.Split(string(arr), ",") {
+		if index, err := strconv.Atoi(indexStr); err == nil {
+			rv = append(rv, index)
+		}
+	}
+	return rv
+}
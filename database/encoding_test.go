@@ -1,6 +1,7 @@
 package database
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -47,3 +48,82 @@ func TestFloat64(t *testing.T) {
 	}
 
 }
+
+func TestText(t *testing.T) {
+	testcases := []string{"", "hello world", "unicode text ü 中文"}
+
+	for _, text := range testcases {
+		t.Run("Text", func(t *testing.T) {
+			if text != byteToText(textToByte(text)) {
+				t.Log(text, byteToText(textToByte(text)))
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestPostings(t *testing.T) {
+	postings := []posting{
+		{1, 3, 0.5, []int{0, 5, 6}},
+		{7, 1, 0, []int{3}},
+		{300, 3, 2.25, []int{1, 1000, 100000}},
+	}
+
+	arr := postingsToByte(postings)
+	if arr[0] != postingsVersion || postingsCount(arr) != len(postings) {
+		t.Log(arr)
+		t.Fail()
+	}
+	if decoded := byteToPostings(arr); !reflect.DeepEqual(decoded, postings) {
+		t.Log(decoded)
+		t.Fail()
+	}
+	if decoded := decodePostings(arr, false); decoded[2].tf != 3 || decoded[2].weight != 2.25 || decoded[2].positions != nil {
+		t.Log(decoded)
+		t.Fail()
+	}
+	if decoded := byteToPostings(postingsToByte(nil)); len(decoded) != 0 {
+		t.Log(decoded)
+		t.Fail()
+	}
+	if positions := legacyToPositions([]byte("0,5,6")); !reflect.DeepEqual(positions, []int{0, 5, 6}) {
+		t.Log(positions)
+		t.Fail()
+	}
+
+	// Appending gives the same encoding as encoding all postings
+	if lastPageId(postingsToByte(postings[:2])) != 7 || lastPageId(arr) != 300 {
+		t.Fail()
+	}
+	if appended := appendPostings(postingsToByte(postings[:1]), postings[1:]); !reflect.DeepEqual(appended, arr) {
+		t.Log(appended)
+		t.Fail()
+	}
+	for i := 0; i < 200; i++ {
+		postings = append(postings, posting{uint64(301 + i), 1, 0, []int{i}})
+	}
+	if appended := appendPostings(arr, postings[3:]); !reflect.DeepEqual(appended, postingsToByte(postings)) {
+		t.Log(appended)
+		t.Fail()
+	}
+}
+
+func TestCorruptPostings(t *testing.T) {
+	huge := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+
+	// A huge count, then a posting with a huge term frequency
+	arr := append([]byte{postingsVersion}, huge...)
+	arr = append(append(arr, 1, 0, 0, 0, 0, 0, 0, 0, 0), huge...)
+	for _, withPositions := range []bool{true, false} {
+		if decoded := decodePostings(arr, withPositions); len(decoded) != 1 || decoded[0].tf > len(arr) {
+			t.Error("Wrong postings of a corrupt list", decoded)
+		}
+	}
+
+	// Truncated lists end early
+	truncated := postingsToByte([]posting{{1, 3, 0.5, []int{0, 5, 6}}})
+	truncated = truncated[:len(truncated)-2]
+	if decoded := byteToPostings(truncated); len(decoded) != 1 {
+		t.Error("Wrong postings of a truncated list", decoded)
+	}
+}
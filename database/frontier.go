@@ -0,0 +1,243 @@
+package database
+
+import (
+	"math"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/rsmohamad/comp4321/models"
+)
+
+// The crawl frontier is kept in two tables so that a crawl can be resumed.
+// CrawlState maps every URL seen by the crawler to its state, doubling as the visited set.
+// CrawlQueue maps a queue key to a queued URL. Keys order the queue by priority,
+// then by last modification with the newest first, then first in first out.
+
+// Priority of URLs found through links
+const DefaultCrawlPriority = 0.5
+
+// Priority of the starting pages, ahead of any sitemap entry
+const SeedCrawlPriority = 1.0
+
+// URLs without a last modification are queued as if modified this long before the crawl,
+// so they are neither ahead of nor behind every sitemap entry of the same priority
+const unknownLastmodAge = 30 * 24 * time.Hour
+
+var unknownLastmod = time.Now().Add(-unknownLastmodAge).Unix()
+
+func queueKey(priority float64, lastmod int64, seq uint64) []byte {
+	if lastmod == 0 {
+		lastmod = unknownLastmod
+	}
+	priority = math.Max(0, math.Min(1, priority))
+	key := []byte{255 - byte(math.Floor(priority*100+0.5))}
+	key = append(key, uint64ToByte(^uint64(lastmod))...)
+	return append(key, uint64ToByte(seq)...)
+}
+
+// Returns the queue key of the URL
+func enqueue(tx *bolt.Tx, url string, priority float64, lastmod int64) []byte {
+	queue := tx.Bucket(intToByte(CrawlQueue))
+	seq, _ := queue.NextSequence()
+	key := queueKey(priority, lastmod, seq)
+	queue.Put(key, []byte(url))
+	return key
+}
+
+// Update the status of a URL, keeping its depth.
+// URLs that leave the queue, e.g. when fetched through a redirect, are taken out of it.
+// Returns the new state.
+func putCrawlState(tx *bolt.Tx, url string, status models.CrawlStatus, reason string) models.CrawlState {
+	states := tx.Bucket(intToByte(CrawlState))
+	var state models.CrawlState
+	if res := states.Get([]byte(url)); res != nil {
+		state = byteToCrawlState(res)
+	}
+	if status != models.Queued && state.QueueKey != nil {
+		queue := tx.Bucket(intToByte(CrawlQueue))
+		if string(queue.Get(state.QueueKey)) == url {
+			queue.Delete(state.QueueKey)
+		}
+		state.QueueKey = nil
+	}
+	state.Status = status
+	state.Reason = reason
+	state.Time = time.Now().Unix()
+	states.Put([]byte(url), crawlStateToByte(state))
+	return state
+}
+
+// Add the URLs that were never seen to the queue at the given depth with the default priority.
+// Returns the URLs that were added.
+func (i *Indexer) EnqueueUrls(urls []string, depth int) (added []string) {
+	entries := make([]models.QueuedUrl, len(urls))
+	for j, url := range urls {
+		entries[j] = models.QueuedUrl{Url: url, Depth: depth, Priority: DefaultCrawlPriority}
+	}
+	return i.Enqueue(entries)
+}
+
+// Add the starting pages of a crawl to the queue, see GetSeeds.
+// Returns the URLs that were added.
+func (i *Indexer) EnqueueSeeds(urls []string) (added []string) {
+	entries := make([]models.QueuedUrl, len(urls))
+	for j, url := range urls {
+		entries[j] = models.QueuedUrl{Url: url, Priority: SeedCrawlPriority, Seed: true}
+	}
+	return i.Enqueue(entries)
+}
+
+// Add the URLs that were never seen to the queue.
+// Seeds that were seen are only marked as seeds.
+// Returns the URLs that were added.
+func (i *Indexer) Enqueue(entries []models.QueuedUrl) (added []string) {
+	i.db.Update(func(tx *bolt.Tx) error {
+		states := tx.Bucket(intToByte(CrawlState))
+		for _, entry := range entries {
+			if res := states.Get([]byte(entry.Url)); res != nil {
+				if state := byteToCrawlState(res); entry.Seed && !state.Seed {
+					state.Seed = true
+					states.Put([]byte(entry.Url), crawlStateToByte(state))
+				}
+				continue
+			}
+			state := models.CrawlState{
+				QueueKey: enqueue(tx, entry.Url, entry.Priority, entry.Lastmod),
+				Status:   models.Queued,
+				Time:     time.Now().Unix(),
+				Depth:    entry.Depth,
+				Priority: entry.Priority,
+				Lastmod:  entry.Lastmod,
+				Seed:     entry.Seed,
+			}
+			states.Put([]byte(entry.Url), crawlStateToByte(state))
+			added = append(added, entry.Url)
+		}
+		return nil
+	})
+	return
+}
+
+// Take up to num URLs from the front of the queue and mark them in-flight
+func (i *Indexer) DequeueUrls(num int) (urls []string) {
+	i.db.Update(func(tx *bolt.Tx) error {
+		queue := tx.Bucket(intToByte(CrawlQueue))
+		c := queue.Cursor()
+		for k, v := c.First(); k != nil && len(urls) < num; k, v = c.First() {
+			url := string(v)
+			c.Delete()
+			putCrawlState(tx, url, models.InFlight, "")
+			urls = append(urls, url)
+		}
+		return nil
+	})
+	return
+}
+
+// Record the outcome of fetching a URL
+func (i *Indexer) SetCrawlState(url string, status models.CrawlStatus, reason string) {
+	i.db.Batch(func(tx *bolt.Tx) error {
+		putCrawlState(tx, url, status, reason)
+		return nil
+	})
+}
+
+// Record that url was fetched through a redirect from another URL.
+// URLs that were already fetched themselves are left as they are.
+func (i *Indexer) SetRedirectTarget(url, from string) {
+	i.db.Batch(func(tx *bolt.Tx) error {
+		states := tx.Bucket(intToByte(CrawlState))
+		if res := states.Get([]byte(url)); res != nil && byteToCrawlState(res).Status == models.Fetched {
+			return nil
+		}
+		state := putCrawlState(tx, url, models.Fetched, "")
+		state.RedirectedFrom = from
+		states.Put([]byte(url), crawlStateToByte(state))
+		return nil
+	})
+}
+
+// Returns the state of a URL in the frontier.
+// Returns false if the crawler has not seen the URL.
+func (i *Indexer) GetCrawlState(url string) (state models.CrawlState, found bool) {
+	i.db.View(func(tx *bolt.Tx) error {
+		res := tx.Bucket(intToByte(CrawlState)).Get([]byte(url))
+		if res != nil {
+			state = byteToCrawlState(res)
+			found = true
+		}
+		return nil
+	})
+	return
+}
+
+// Iterate over the states of all URLs seen by the crawler
+func (i *Indexer) ForEachCrawlState(fn func(url string, state models.CrawlState)) {
+	i.db.View(func(tx *bolt.Tx) error {
+		tx.Bucket(intToByte(CrawlState)).ForEach(func(k, v []byte) error {
+			fn(string(k), byteToCrawlState(v))
+			return nil
+		})
+		return nil
+	})
+}
+
+// Returns the starting pages of the crawl in the frontier
+func (i *Indexer) GetSeeds() (seeds []string) {
+	i.ForEachCrawlState(func(url string, state models.CrawlState) {
+		if state.Seed {
+			seeds = append(seeds, url)
+		}
+	})
+	return
+}
+
+// Returns the number of URLs in each state
+func (i *Indexer) CountCrawlStates() map[models.CrawlStatus]int {
+	rv := make(map[models.CrawlStatus]int)
+	i.ForEachCrawlState(func(_ string, state models.CrawlState) {
+		rv[state.Status]++
+	})
+	return rv
+}
+
+// Put the URLs that were in-flight when the crawl stopped back in the queue.
+// Returns the number of requeued URLs.
+func (i *Indexer) RequeueUnfinished() (requeued int) {
+	i.db.Update(func(tx *bolt.Tx) error {
+		states := tx.Bucket(intToByte(CrawlState))
+
+		urls := make([]string, 0)
+		unfinished := make([]models.CrawlState, 0)
+		states.ForEach(func(k, v []byte) error {
+			if state := byteToCrawlState(v); state.Status == models.InFlight || state.Status == models.Skipped {
+				urls = append(urls, string(k))
+				unfinished = append(unfinished, state)
+			}
+			return nil
+		})
+
+		for j, url := range urls {
+			state := unfinished[j]
+			state.QueueKey = enqueue(tx, url, state.Priority, state.Lastmod)
+			state.Status = models.Queued
+			state.Reason = ""
+			state.Time = time.Now().Unix()
+			states.Put([]byte(url), crawlStateToByte(state))
+		}
+		requeued = len(urls)
+		return nil
+	})
+	return
+}
+
+// Forget the frontier of the previous crawl
+func (i *Indexer) ClearFrontier() {
+	i.db.Update(func(tx *bolt.Tx) error {
+		for _, table := range []int{CrawlState, CrawlQueue} {
+			tx.DeleteBucket(intToByte(table))
+			tx.CreateBucket(intToByte(table))
+		}
+		return nil
+	})
+}
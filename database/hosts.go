@@ -0,0 +1,95 @@
+package database
+
+import (
+	"bytes"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// The HostIndex table maps the host of every page to its ID, so that site: queries
+// do not scan every URL. Keys are the host with its labels reversed, a 0 byte and the
+// page ID, e.g. "hk.ust.cse\x00<page id>", so the pages of a host and its subdomains
+// are the keys starting with the reversed host.
+
+// Returns the host with its labels reversed, e.g. "hk.ust.cse" for "cse.ust.hk"
+func reverseHost(host string) string {
+	labels := strings.Split(strings.ToLower(host), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".")
+}
+
+// Returns the key of the page in the host index, or nil if the URL has no host
+func hostKey(link string, pageId []byte) []byte {
+	urlObject, err := url.Parse(link)
+	if err != nil || urlObject.Hostname() == "" {
+		return nil
+	}
+
+	key := append([]byte(reverseHost(urlObject.Hostname())), 0)
+	return append(key, pageId...)
+}
+
+// Add the page to the host index
+func putHost(tx *bolt.Tx, link string, pageId []byte) {
+	if key := hostKey(link, pageId); key != nil {
+		tx.Bucket(intToByte(HostIndex)).Put(key, []byte{})
+	}
+}
+
+// Remove the page from the host index
+func deleteHost(tx *bolt.Tx, link string, pageId []byte) {
+	if key := hostKey(link, pageId); key != nil {
+		tx.Bucket(intToByte(HostIndex)).Delete(key)
+	}
+}
+
+// Index the hosts of all pages of indexes written before the host index.
+// Returns the number of pages indexed.
+func migrateHosts(db *bolt.DB) (migrated int) {
+	db.Update(func(tx *bolt.Tx) error {
+		if k, _ := tx.Bucket(intToByte(HostIndex)).Cursor().First(); k != nil {
+			return nil
+		}
+
+		tx.Bucket(intToByte(PageIdToUrl)).ForEach(func(pageId, link []byte) error {
+			putHost(tx, string(link), pageId)
+			migrated++
+			return nil
+		})
+		return nil
+	})
+	return
+}
+
+// Returns the IDs of the pages on the host or its subdomains, in ascending order.
+// Returns false if the index has no host index, see GetPageIdsByUrl.
+func (v *Viewer) GetPageIdsByHost(host string) (rv []uint64, indexed bool) {
+	rv = make([]uint64, 0)
+	prefix := []byte(reverseHost(host))
+	v.db.View(func(tx *bolt.Tx) error {
+		hosts := tx.Bucket(intToByte(HostIndex))
+		if hosts == nil {
+			return nil
+		}
+		indexed = true
+
+		c := hosts.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			// The host itself, or a subdomain
+			if next := k[len(prefix)]; next == 0 || next == '.' {
+				rv = append(rv, byteToUint64(k[len(k)-8:]))
+			}
+		}
+		return nil
+	})
+
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i] < rv[j]
+	})
+	return
+}
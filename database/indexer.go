@@ -5,7 +5,6 @@ import (
 	"github.com/rsmohamad/comp4321/models"
 	"math"
 	"sort"
-	"strings"
 	"sync"
 
 	"github.com/boltdb/bolt"
@@ -42,6 +41,16 @@ func LoadIndexer(filename string) (*Indexer, error) {
 		}
 		return nil
 	})
+
+	if migrated := migratePostings(indexer.db); migrated > 0 {
+		fmt.Printf("Migrated the postings of %d words\n", migrated)
+	}
+	if migrated := migrateHosts(indexer.db); migrated > 0 {
+		fmt.Printf("Indexed the hosts of %d pages\n", migrated)
+	}
+	if migrated := migrateClusters(indexer.db); migrated > 0 {
+		fmt.Printf("Indexed the clusters of %d near duplicates\n", migrated)
+	}
 	return &indexer, nil
 }
 
@@ -101,6 +110,7 @@ func (i *Indexer) getOrCreatePageId(url string) (pageId []byte) {
 		fwTitle := tx.Bucket(intToByte(ForwardTableTitle))
 		fw.CreateBucketIfNotExists(pageId)
 		fwTitle.CreateBucketIfNotExists(pageId)
+		putHost(tx, url, pageId)
 		return nil
 	})
 	return
@@ -142,33 +152,46 @@ func (i *Indexer) updateInverted(word string, indexes []int, pageId []byte, isTi
 	// Non critical section
 }
 
-func (i *Indexer) mergeWord(id uint64, wg *sync.WaitGroup, title bool) {
-	memIndex := i.wordInverted
+func (i *Indexer) mergeWord(id uint64, memIndex map[uint64]map[uint64][]int, wg *sync.WaitGroup, title bool) {
 	tablename := intToByte(InvertedTable)
-
 	if title {
-		memIndex = i.titleInverted
 		tablename = intToByte(InvertedTableTitle)
 	}
 
 	i.db.Batch(func(tx *bolt.Tx) error {
 		idBytes := uint64ToByte(id)
 		inverted := tx.Bucket(tablename)
-		wordSet, _ := inverted.CreateBucketIfNotExists(idBytes)
-		postingList := memIndex[id]
-		for docId, idx := range postingList {
-			pos := strings.Trim(strings.Replace(fmt.Sprint(idx), " ", ",", -1), "[]")
-			wordSet.Put(uint64ToByte(docId), []byte(pos))
+
+		// Pages crawled after the stored ones are appended without decoding the list
+		stored := inverted.Get(idBytes)
+		last := lastPageId(stored)
+		appended := len(stored) > 0
+		for pageId := range memIndex[id] {
+			appended = appended && pageId > last
 		}
+		if appended {
+			if encoded := appendPostings(stored, mergePostings(nil, memIndex[id])); encoded != nil {
+				inverted.Put(idBytes, encoded)
+				return nil
+			}
+		}
+
+		putPostings(inverted, idBytes, mergePostings(getPostings(inverted, idBytes), memIndex[id]))
 		return nil
 	})
 	wg.Done()
 }
 
-// Sort and write the in-memory inverted index to file
+// Sort and write the in-memory inverted index to file.
+// The in-memory index is emptied, so it can be flushed again later in a crawl.
 func (i *Indexer) FlushInverted() {
-	wordIdList := i.wordIdList
-	titleIdList := i.titleIdList
+	i.mapLock.Lock()
+	wordInverted, titleInverted := i.wordInverted, i.titleInverted
+	wordIdList, titleIdList := i.wordIdList, i.titleIdList
+	i.wordInverted = make(map[uint64]map[uint64][]int)
+	i.titleInverted = make(map[uint64]map[uint64][]int)
+	i.wordIdList, i.titleIdList = nil, nil
+	i.mapLock.Unlock()
 
 	// Sort slices for sequential writes
 	sort.Slice(wordIdList, func(i, j int) bool {
@@ -181,10 +204,10 @@ func (i *Indexer) FlushInverted() {
 	wg := sync.WaitGroup{}
 	wg.Add(len(wordIdList) + len(titleIdList))
 	for _, id := range wordIdList {
-		go i.mergeWord(id, &wg, false)
+		go i.mergeWord(id, wordInverted, &wg, false)
 	}
 	for _, id := range titleIdList {
-		go i.mergeWord(id, &wg, true)
+		go i.mergeWord(id, titleInverted, &wg, true)
 	}
 	wg.Wait()
 }
@@ -210,6 +233,26 @@ func (i *Indexer) ContainsUrl(url string) (present bool) {
 	return
 }
 
+// Returns the stored document for the URL.
+// Returns nil if the URL is not indexed.
+func (i *Indexer) GetDocument(url string) (document *models.Document) {
+	i.db.View(func(tx *bolt.Tx) error {
+		pageId := tx.Bucket(intToByte(UrlToPageId)).Get([]byte(url))
+		if pageId == nil {
+			return nil
+		}
+
+		docBytes := tx.Bucket(intToByte(PageInfo)).Get(pageId)
+		if docBytes == nil {
+			return nil
+		}
+
+		document = byteToDoc(docBytes)
+		return nil
+	})
+	return
+}
+
 func (i *Indexer) setMaxTf(pageId []byte, maxTf, titleMaxTf int) {
 	i.db.Batch(func(tx *bolt.Tx) error {
 		maxTfTable := tx.Bucket(intToByte(MaxTf))
@@ -220,13 +263,89 @@ func (i *Indexer) setMaxTf(pageId []byte, maxTf, titleMaxTf int) {
 	})
 }
 
+// Remove a page from the in-memory inverted index
+func (i *Indexer) removeFromMemory(wordId, pageId uint64, title bool) {
+	i.mapLock.Lock()
+	if !title {
+		delete(i.wordInverted[wordId], pageId)
+	} else {
+		delete(i.titleInverted[wordId], pageId)
+	}
+	i.mapLock.Unlock()
+}
+
+// Delete the postings of the given words for a page.
+// Removes the entries from the forward, inverted and weight tables.
+func (i *Indexer) deletePostings(tx *bolt.Tx, pageId []byte, wordIds [][]byte, title bool) {
+	tableNames := []int{ForwardTable, InvertedTable, TermWeights}
+	if title {
+		tableNames = []int{ForwardTableTitle, InvertedTableTitle, TitleWeights}
+	}
+
+	fw := tx.Bucket(intToByte(tableNames[0])).Bucket(pageId)
+	inverted := tx.Bucket(intToByte(tableNames[1]))
+	weights := tx.Bucket(intToByte(tableNames[2])).Bucket(pageId)
+
+	for _, wordId := range wordIds {
+		if fw != nil {
+			fw.Delete(wordId)
+		}
+		if weights != nil {
+			weights.Delete(wordId)
+		}
+
+		// The posting list is dropped altogether once no page contains the word
+		postings := getPostings(inverted, wordId)
+		if findPosting(postings, byteToUint64(pageId)) >= 0 {
+			putPostings(inverted, wordId, removePosting(postings, byteToUint64(pageId)))
+		}
+
+		i.removeFromMemory(byteToUint64(wordId), byteToUint64(pageId), title)
+	}
+}
+
+// Remove postings of words that the page no longer contains.
+// Diffs the stored forward index against the words of the new document.
+func (i *Indexer) removeStalePostings(pageId []byte, words map[string]models.Word, title bool) {
+	tablename := ForwardTable
+	if title {
+		tablename = ForwardTableTitle
+	}
+
+	i.db.Update(func(tx *bolt.Tx) error {
+		fw := tx.Bucket(intToByte(tablename)).Bucket(pageId)
+		idToWord := tx.Bucket(intToByte(WordIdToWord))
+		if fw == nil {
+			return nil
+		}
+
+		stale := make([][]byte, 0)
+		fw.ForEach(func(wordId, _ []byte) error {
+			if _, present := words[string(idToWord.Get(wordId))]; !present {
+				id := make([]byte, len(wordId))
+				copy(id, wordId)
+				stale = append(stale, id)
+			}
+			return nil
+		})
+
+		i.deletePostings(tx, pageId, stale, title)
+		return nil
+	})
+}
+
 // Insert page into the database.
 // This will update all mapping tables and indexes.
-func (i *Indexer) UpdateOrAddPage(p *models.Document) {
+// If the page already exists, postings of words that no longer appear are removed.
+// Returns the URL of the page it is a near duplicate of, or "" if there is none.
+func (i *Indexer) UpdateOrAddPage(p *models.Document) (duplicateOf string) {
 	pageId := i.getOrCreatePageId(p.Uri)
 	var wg sync.WaitGroup
 	fmt.Println(pageId, p.Uri)
 
+	i.removeStalePostings(pageId, p.Words, false)
+	i.removeStalePostings(pageId, p.Titles, true)
+
 	wg.Add(len(p.Words) + len(p.Titles))
 	for word, wordModel := range p.Words {
 		go func(w string, t int, idx []int) {
@@ -244,76 +363,225 @@ func (i *Indexer) UpdateOrAddPage(p *models.Document) {
 	}
 	wg.Wait()
 	i.setMaxTf(pageId, p.MaxTf, p.TitleMaxTf)
+
+	// Text is compressed into its own table to keep PageInfo small
+	stored := *p
+	stored.Text = ""
 	i.db.Batch(func(tx *bolt.Tx) error {
 		documents := tx.Bucket(intToByte(PageInfo))
-		encoded := docToByte(p)
+		encoded := docToByte(&stored)
 		documents.Put(pageId, encoded)
+		tx.Bucket(intToByte(PageText)).Put(pageId, textToByte(p.Text))
+		return nil
+	})
+
+	if rep := i.updateFingerprint(pageId, p.Fingerprint); rep != 0 {
+		i.db.View(func(tx *bolt.Tx) error {
+			duplicateOf = string(tx.Bucket(intToByte(PageIdToUrl)).Get(uint64ToByte(rep)))
+			return nil
+		})
+	}
+	return
+}
+
+// Delete a page and all of its postings from the database.
+// Returns false if the URL is not indexed.
+func (i *Indexer) DeletePage(url string) (deleted bool) {
+	i.idLock.Lock()
+	defer i.idLock.Unlock()
+
+	i.db.Update(func(tx *bolt.Tx) error {
+		urlToId := tx.Bucket(intToByte(UrlToPageId))
+		id := urlToId.Get([]byte(url))
+		if id == nil {
+			return nil
+		}
+		pageId := make([]byte, len(id))
+		copy(pageId, id)
+
+		// Postings in forward, inverted and weight tables
+		for _, title := range []bool{false, true} {
+			tablename := ForwardTable
+			if title {
+				tablename = ForwardTableTitle
+			}
+
+			wordIds := make([][]byte, 0)
+			fw := tx.Bucket(intToByte(tablename)).Bucket(pageId)
+			if fw != nil {
+				fw.ForEach(func(wordId, _ []byte) error {
+					id := make([]byte, len(wordId))
+					copy(id, wordId)
+					wordIds = append(wordIds, id)
+					return nil
+				})
+			}
+			i.deletePostings(tx, pageId, wordIds, title)
+		}
+
+		for _, table := range []int{ForwardTable, ForwardTableTitle, TermWeights, TitleWeights} {
+			tx.Bucket(intToByte(table)).DeleteBucket(pageId)
+		}
+
+		for _, table := range []int{PageMagnitude, TitleMagnitude, MaxTf, TitleMaxTf, PageInfo, PageRank, PageLength, TitleLength, PageText} {
+			tx.Bucket(intToByte(table)).Delete(pageId)
+		}
+
+		// Remove the page both as a child and as a parent in the adjacency list
+		adjList := tx.Bucket(intToByte(AdjList))
+		adjList.DeleteBucket(pageId)
+		adjList.ForEach(func(childId, _ []byte) error {
+			adjList.Bucket(childId).Delete(pageId)
+			return nil
+		})
+
+		i.removeFingerprint(tx, pageId)
+
+		deleteHost(tx, url, pageId)
+		urlToId.Delete([]byte(url))
+		tx.Bucket(intToByte(PageIdToUrl)).Delete(pageId)
+		deleted = true
 		return nil
 	})
+	return
 }
 
+// Compute the tf-idf weight of every posting in a single pass over the inverted table.
+// Weights are stored in the posting lists, for scoring queries, and in the term weight
+// table by page. The magnitude table is rebuilt from the weights.
 func (v *Indexer) updateTermScores(title bool) {
-	tableNames := []int{ForwardTable, TermWeights, PageMagnitude}
+	tableNames := []int{InvertedTable, TermWeights, PageMagnitude, MaxTf}
 	if title {
-		tableNames = []int{ForwardTableTitle, TitleWeights, TitleMagnitude}
+		tableNames = []int{InvertedTableTitle, TitleWeights, TitleMagnitude, TitleMaxTf}
 	}
 
 	v.db.Update(func(tx *bolt.Tx) error {
-		ft := tx.Bucket(intToByte(tableNames[0]))
+		inverted := tx.Bucket(intToByte(tableNames[0]))
 		tw := tx.Bucket(intToByte(tableNames[1]))
-		mag := tx.Bucket(intToByte(tableNames[2]))
+		maxBucket := tx.Bucket(intToByte(tableNames[3]))
+		numPages := float64(tx.Bucket(intToByte(PageIdToUrl)).Stats().KeyN)
 
-		ft.ForEach(func(docId, _ []byte) error {
-			pageSet, _ := tw.CreateBucketIfNotExists(docId)
-			sum := 0.0
-			ft.Bucket(docId).ForEach(func(wordId, val []byte) error {
-				termWeight := v.calculateTermScore(docId, wordId, title)
-				sum += termWeight * termWeight
-				pageSet.Put(wordId, float64ToByte(termWeight))
+		// Postings cannot be replaced while iterating over them
+		wordIds := make([][]byte, 0)
+		inverted.ForEach(func(wordId, _ []byte) error {
+			wordIds = append(wordIds, append([]byte(nil), wordId...))
+			return nil
+		})
+
+		maxTf := make(map[uint64]int)
+		sums := make(map[uint64]float64)
+		for _, wordId := range wordIds {
+			postings := getPostings(inverted, wordId)
+			idf := math.Log2(numPages / float64(len(postings)))
+			for j := range postings {
+				p := &postings[j]
+				if _, found := maxTf[p.pageId]; !found {
+					maxTf[p.pageId] = byteToInt(maxBucket.Get(uint64ToByte(p.pageId)))
+				}
+
+				p.weight = float64(p.tf) * idf / float64(maxTf[p.pageId])
+				sums[p.pageId] += p.weight * p.weight
+				pageSet, _ := tw.CreateBucketIfNotExists(uint64ToByte(p.pageId))
+				pageSet.Put(wordId, float64ToByte(p.weight))
+			}
+			putPostings(inverted, wordId, postings)
+		}
+
+		tx.DeleteBucket(intToByte(tableNames[2]))
+		mag, _ := tx.CreateBucket(intToByte(tableNames[2]))
+		for pageId, sum := range sums {
+			mag.Put(uint64ToByte(pageId), float64ToByte(math.Sqrt(sum)))
+		}
+		return nil
+	})
+}
+
+// Store the upper bounds of the scores of each word, used to prune queries.
+// Must run after the term weights, magnitudes and lengths are updated.
+func (i *Indexer) updateTermBounds(title bool) {
+	tableNames := []int{InvertedTable, PageMagnitude, PageLength, TermBounds}
+	if title {
+		tableNames = []int{InvertedTableTitle, TitleMagnitude, TitleLength, TitleTermBounds}
+	}
+
+	i.db.Update(func(tx *bolt.Tx) error {
+		inverted := tx.Bucket(intToByte(tableNames[0]))
+		mag := tx.Bucket(intToByte(tableNames[1]))
+		lengths := tx.Bucket(intToByte(tableNames[2]))
+		tx.DeleteBucket(intToByte(tableNames[3]))
+		bounds, _ := tx.CreateBucket(intToByte(tableNames[3]))
+
+		inverted.ForEach(func(wordId, val []byte) error {
+			postings := decodePostings(val, false)
+			if len(postings) == 0 {
 				return nil
-			})
-			mag.Put(docId, float64ToByte(math.Sqrt(sum)))
+			}
+
+			bound := TermBound{MinLength: math.MaxInt32}
+			for _, p := range postings {
+				pageId := uint64ToByte(p.pageId)
+				if val := mag.Get(pageId); val != nil && byteToFloat64(val) > 0 {
+					bound.Cosine = math.Max(bound.Cosine, p.weight/byteToFloat64(val))
+				}
+				if p.tf > bound.MaxTf {
+					bound.MaxTf = p.tf
+				}
+				if length := byteToInt(lengths.Get(pageId)); length < bound.MinLength {
+					bound.MinLength = length
+				}
+			}
+			bounds.Put(wordId, termBoundToByte(bound))
 			return nil
 		})
 		return nil
 	})
 }
 
-func (v *Indexer) calculateTermScore(docId, wordId []byte, title bool) float64 {
-	tableNames := []int{InvertedTable, ForwardTable, MaxTf}
+// Store the length of each document and the average length over all documents.
+// The length of a document is the sum of the term frequencies in the forward table.
+func (i *Indexer) updateLengths(title bool) {
+	tableNames := []int{ForwardTable, PageLength, AvgPageLength}
 	if title {
-		tableNames = []int{InvertedTableTitle, ForwardTableTitle, TitleMaxTf}
+		tableNames = []int{ForwardTableTitle, TitleLength, AvgTitleLength}
 	}
 
-	rv := 0.0
-	v.db.View(func(tx *bolt.Tx) error {
-		itBucket := tx.Bucket(intToByte(tableNames[0]))
-		ftBucket := tx.Bucket(intToByte(tableNames[1]))
-		maxBucket := tx.Bucket(intToByte(tableNames[2]))
-		pages := tx.Bucket(intToByte(PageIdToUrl))
-
-		numPages := float64(pages.Stats().KeyN)
-		maxTf := byteToInt(maxBucket.Get(docId))
-		wordSet := ftBucket.Bucket(docId)
-		tfByte := wordSet.Get(wordId)
-		if tfByte == nil {
+	i.db.Update(func(tx *bolt.Tx) error {
+		ft := tx.Bucket(intToByte(tableNames[0]))
+		lengths := tx.Bucket(intToByte(tableNames[1]))
+		stats := tx.Bucket(intToByte(CollectionStats))
+		total, count := 0, 0
+
+		ft.ForEach(func(docId, _ []byte) error {
+			length := 0
+			ft.Bucket(docId).ForEach(func(_, tf []byte) error {
+				length += byteToInt(tf)
+				return nil
+			})
+			lengths.Put(docId, intToByte(length))
+			total += length
+			count++
 			return nil
-		}
+		})
 
-		df := float64(itBucket.Bucket(wordId).Stats().KeyN)
-		tf := float64(byteToInt(tfByte))
-		rv = tf * math.Log2(numPages/df) / float64(maxTf)
+		avg := 0.0
+		if count > 0 {
+			avg = float64(total) / float64(count)
+		}
+		stats.Put(intToByte(tableNames[2]), float64ToByte(avg))
 		return nil
 	})
-	return rv
 }
 
-// Update term weights
-// TF, N, keywords per page, and pages are retrieved from forward table
-// DF is retrieved from inverted index
+// Update term weights, document lengths and the score bounds of each term
+// TF and DF are retrieved from the inverted index, N from the page table
+// Lengths are retrieved from the forward table
 func (i *Indexer) UpdateTermWeights() {
 	i.updateTermScores(false)
 	i.updateTermScores(true)
+	i.updateLengths(false)
+	i.updateLengths(true)
+	i.updateTermBounds(false)
+	i.updateTermBounds(true)
 }
 
 // Update Adjacency List
@@ -355,8 +623,10 @@ func (i *Indexer) UpdateAdjList() {
 		return childIds[i] < childIds[j]
 	})
 
+	// Rebuild the table so that links removed from updated pages are dropped
 	i.db.Update(func(tx *bolt.Tx) error {
-		alBucket := tx.Bucket(intToByte(AdjList))
+		tx.DeleteBucket(intToByte(AdjList))
+		alBucket, _ := tx.CreateBucket(intToByte(AdjList))
 		for _, id := range childIds {
 			idBytes := uint64ToByte(id)
 			pageSet, _ := alBucket.CreateBucketIfNotExists(idBytes)
@@ -368,44 +638,111 @@ func (i *Indexer) UpdateAdjList() {
 	})
 }
 
-// Calculates the PageRank iteratively.
-func (i *Indexer) UpdatePageRank() {
-	i.db.Update(func(tx *bolt.Tx) error {
-		prBucket := tx.Bucket(intToByte(PageRank))
-		adjBucket := tx.Bucket(intToByte(AdjList))
-
-		adjBucket.ForEach(func(childID, _ []byte) error {
-			prBucket.Put(childID, float64ToByte(1.0))
-			return nil
-		})
+// PageRank defaults
+const (
+	DefaultDamping   = 0.85
+	DefaultTolerance = 1e-6
 
-		pageRank := make(map[uint64]float64)
+	// Upper bound on iterations if the ranks do not converge
+	MaxPageRankIterations = 100
+)
 
-		for i := 0; i < 15; i++ {
-			adjBucket.ForEach(func(childID, _ []byte) error {
-				parents := adjBucket.Bucket(childID)
-				d := 0.15
-				totalParentPR := 0.0
+// Calculates the PageRank with the default damping factor and tolerance.
+// Returns the number of iterations and the final L1 residual.
+func (i *Indexer) UpdatePageRank() (int, float64) {
+	iterations, residual, _ := i.UpdatePageRankWith(DefaultDamping, DefaultTolerance)
+	return iterations, residual
+}
 
-				parents.ForEach(func(parentID, totalChild []byte) error {
-					parentPR := prBucket.Get(parentID)
+// Calculates the PageRank iteratively over the adjacency list.
+// Every page starts with rank 1/N. The rank of pages without outgoing links
+// is spread evenly over all pages. Iterates until the L1 distance between
+// two iterations is below tolerance, and normalises the ranks to sum to 1.
+// Returns the number of iterations and the final L1 residual.
+// Returns an error and leaves the ranks as they are unless 0 <= damping < 1 and tolerance > 0,
+// as ranks diverge or turn negative otherwise.
+func (i *Indexer) UpdatePageRankWith(damping, tolerance float64) (iterations int, residual float64, err error) {
+	if !(damping >= 0 && damping < 1) {
+		return 0, 0, fmt.Errorf("damping factor must be at least 0 and below 1, got %v", damping)
+	}
+	if !(tolerance > 0) {
+		return 0, 0, fmt.Errorf("tolerance must be positive, got %v", tolerance)
+	}
 
-					if len(parentPR) > 0 {
-						totalParentPR = totalParentPR + (byteToFloat64(parentPR) / float64(byteToInt(totalChild)))
-					}
-					return nil
-				})
+	pageIds := make([]uint64, 0)
+	parents := make(map[uint64][]uint64)
+	outDegree := make(map[uint64]int)
 
-				pageRank[byteToUint64(childID)] = 1.0 - d + (d * totalParentPR)
+	i.db.View(func(tx *bolt.Tx) error {
+		tx.Bucket(intToByte(PageIdToUrl)).ForEach(func(pageId, _ []byte) error {
+			pageIds = append(pageIds, byteToUint64(pageId))
+			return nil
+		})
 
+		// Count only links to indexed pages, so that no rank leaks out of the graph
+		adjBucket := tx.Bucket(intToByte(AdjList))
+		adjBucket.ForEach(func(childId, _ []byte) error {
+			child := byteToUint64(childId)
+			adjBucket.Bucket(childId).ForEach(func(parentId, _ []byte) error {
+				parent := byteToUint64(parentId)
+				parents[child] = append(parents[child], parent)
+				outDegree[parent]++
 				return nil
 			})
+			return nil
+		})
+		return nil
+	})
 
-			for id, pr := range pageRank {
-				prBucket.Put(uint64ToByte(id), float64ToByte(pr))
+	numPages := float64(len(pageIds))
+	if numPages == 0 {
+		return 0, 0, nil
+	}
+
+	pageRank := make(map[uint64]float64)
+	for _, id := range pageIds {
+		pageRank[id] = 1 / numPages
+	}
+
+	for iterations < MaxPageRankIterations {
+		dangling := 0.0
+		for _, id := range pageIds {
+			if outDegree[id] == 0 {
+				dangling += pageRank[id]
 			}
 		}
 
+		next := make(map[uint64]float64)
+		total := 0.0
+		for _, id := range pageIds {
+			incoming := 0.0
+			for _, parent := range parents[id] {
+				incoming += pageRank[parent] / float64(outDegree[parent])
+			}
+			next[id] = (1-damping)/numPages + damping*(incoming+dangling/numPages)
+			total += next[id]
+		}
+
+		residual = 0
+		for _, id := range pageIds {
+			next[id] /= total
+			residual += math.Abs(next[id] - pageRank[id])
+		}
+
+		pageRank = next
+		iterations++
+		if residual < tolerance {
+			break
+		}
+	}
+
+	// Rebuild the table so that deleted pages are dropped
+	i.db.Update(func(tx *bolt.Tx) error {
+		tx.DeleteBucket(intToByte(PageRank))
+		prBucket, _ := tx.CreateBucket(intToByte(PageRank))
+		for _, id := range pageIds {
+			prBucket.Put(uint64ToByte(id), float64ToByte(pageRank[id]))
+		}
 		return nil
 	})
 	return
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+// The inverted tables map each word ID to its encoded posting list, see encoding.go.
+// Indexes written before the delta encoding have a bucket per word instead,
+// which the Indexer migrates when it loads the file.
+
+// Returns the postings of a word sorted by page ID.
+// Reads legacy posting buckets of indexes that were not migrated.
+func getPostings(inverted *bolt.Bucket, wordId []byte) []posting {
+	if val := inverted.Get(wordId); val != nil {
+		return byteToPostings(val)
+	}
+
+	docs := inverted.Bucket(wordId)
+	if docs == nil {
+		return nil
+	}
+
+	rv := make([]posting, 0)
+	docs.ForEach(func(pageId, positions []byte) error {
+		pos := legacyToPositions(positions)
+		rv = append(rv, posting{pageId: byteToUint64(pageId), tf: len(pos), positions: pos})
+		return nil
+	})
+	return rv
+}
+
+// Store the postings of a word, or remove the word if it has none
+func putPostings(inverted *bolt.Bucket, wordId []byte, postings []posting) {
+	if inverted.Bucket(wordId) != nil {
+		inverted.DeleteBucket(wordId)
+	}
+
+	if len(postings) == 0 {
+		inverted.Delete(wordId)
+		return
+	}
+	inverted.Put(wordId, postingsToByte(postings))
+}
+
+// Returns the number of pages containing the word
+func documentFrequency(inverted *bolt.Bucket, wordId []byte) int {
+	if val := inverted.Get(wordId); val != nil {
+		return postingsCount(val)
+	}
+
+	docs := inverted.Bucket(wordId)
+	if docs == nil {
+		return 0
+	}
+	return docs.Stats().KeyN
+}
+
+// Returns the index of the page in postings, or -1 if it is not there
+func findPosting(postings []posting, pageId uint64) int {
+	i := sort.Search(len(postings), func(i int) bool {
+		return postings[i].pageId >= pageId
+	})
+	if i < len(postings) && postings[i].pageId == pageId {
+		return i
+	}
+	return -1
+}
+
+// Returns the postings with the positions of the pages in updates replaced.
+// The weights of the replaced postings are left at 0 until UpdateTermWeights.
+func mergePostings(postings []posting, updates map[uint64][]int) []posting {
+	rv := make([]posting, 0, len(postings)+len(updates))
+	for _, p := range postings {
+		if _, updated := updates[p.pageId]; !updated {
+			rv = append(rv, p)
+		}
+	}
+	for pageId, positions := range updates {
+		sorted := append([]int(nil), positions...)
+		sort.Ints(sorted)
+		rv = append(rv, posting{pageId: pageId, tf: len(sorted), positions: sorted})
+	}
+
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].pageId < rv[j].pageId
+	})
+	return rv
+}
+
+// Returns the postings without the page
+func removePosting(postings []posting, pageId uint64) []posting {
+	if i := findPosting(postings, pageId); i >= 0 {
+		return append(postings[:i], postings[i+1:]...)
+	}
+	return postings
+}
+
+// Convert legacy posting buckets to the current encoding.
+// Returns the number of words converted.
+func migratePostings(db *bolt.DB) (migrated int) {
+	db.Update(func(tx *bolt.Tx) error {
+		for _, table := range []int{InvertedTable, InvertedTableTitle} {
+			inverted := tx.Bucket(intToByte(table))
+
+			// Buckets cannot be replaced while iterating over them
+			legacy := make([][]byte, 0)
+			inverted.ForEach(func(wordId, val []byte) error {
+				if val == nil {
+					legacy = append(legacy, append([]byte(nil), wordId...))
+				}
+				return nil
+			})
+
+			for _, wordId := range legacy {
+				putPostings(inverted, wordId, getPostings(inverted, wordId))
+			}
+			migrated += len(legacy)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// How long Verify and Restore wait for the file lock of an index
+const lockTimeout = time.Second
+
+// Tables that every index has, newer tables are created when an Indexer loads it
+var requiredTables = []int{WordToWordId, WordIdToWord, UrlToPageId, PageIdToUrl, InvertedTable, PageInfo}
+
+// Write a consistent copy of the database to w in a read transaction,
+// so the database can still be used meanwhile.
+// Returns the number of bytes written.
+func snapshot(db *bolt.DB, w io.Writer) (n int64, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return
+}
+
+// Write to a temporary file next to path, then rename it to path.
+// Readers of path see either the old or the new file, never a partial one.
+// If verify is set, the file is checked with Verify before it is renamed.
+func writeAtomic(path string, write func(w io.Writer) error, verify bool) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && verify {
+		err = Verify(tmp.Name())
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Write a consistent snapshot of the index to w
+func (i *Indexer) Snapshot(w io.Writer) (int64, error) {
+	return snapshot(i.db, w)
+}
+
+// Write a consistent snapshot of the index to the file at path, replacing it atomically
+func (i *Indexer) SnapshotToFile(path string) error {
+	return writeAtomic(path, func(w io.Writer) error {
+		_, err := i.Snapshot(w)
+		return err
+	}, false)
+}
+
+// Write a consistent snapshot of the index to w
+func (v *Viewer) Snapshot(w io.Writer) (int64, error) {
+	return snapshot(v.db, w)
+}
+
+// Write a consistent snapshot of the index to the file at path, replacing it atomically
+func (v *Viewer) SnapshotToFile(path string) error {
+	return writeAtomic(path, func(w io.Writer) error {
+		_, err := v.Snapshot(w)
+		return err
+	}, false)
+}
+
+// Check that the file at path is a consistent index.
+// Returns an error if the file is not a BoltDB file, is corrupted, or lacks the tables of an index.
+func Verify(path string) error {
+	// Opening creates missing files
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(path, 0666, &bolt.Options{ReadOnly: true, Timeout: lockTimeout})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) (err error) {
+		// Bolt panics on some malformed pages
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("corrupted index: %v", r)
+			}
+		}()
+
+		if err := checkTables(tx); err != nil {
+			return err
+		}
+
+		// Read every page here first, since a panic in the check below cannot be recovered
+		tx.ForEach(func(name []byte, table *bolt.Bucket) error {
+			readBucket(table)
+			return nil
+		})
+
+		// The check reads the file until it closes the channel, so it is drained
+		// before the transaction ends. Returns the first error found.
+		for checkErr := range tx.Check() {
+			if err == nil {
+				err = checkErr
+			}
+		}
+		return err
+	})
+}
+
+// Returns an error if a table of the index is missing
+func checkTables(tx *bolt.Tx) error {
+	for _, table := range requiredTables {
+		if tx.Bucket(intToByte(table)) == nil {
+			return fmt.Errorf("missing table %d", table)
+		}
+	}
+	return nil
+}
+
+// Read all keys of the bucket and of the buckets nested in it
+func readBucket(b *bolt.Bucket) {
+	b.ForEach(func(key, val []byte) error {
+		if val == nil {
+			readBucket(b.Bucket(key))
+		}
+		return nil
+	})
+}
+
+// Returns an error if an Indexer has the index at path open
+func checkNotWriting(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	db, err := bolt.Open(path, 0666, &bolt.Options{ReadOnly: true, Timeout: lockTimeout})
+	if err == bolt.ErrTimeout {
+		return errors.New("index is open for writing: " + path)
+	}
+	if err == nil {
+		db.Close()
+	}
+	return nil
+}
+
+// Move the index at src over the index at path.
+// Like Restore, but renames src instead of copying it, so both must be on the same file system.
+func Replace(src, path string) error {
+	if err := Verify(src); err != nil {
+		return err
+	}
+	if err := checkNotWriting(path); err != nil {
+		return err
+	}
+	return os.Rename(src, path)
+}
+
+// Replace the index at path with the snapshot read from r.
+// The snapshot is verified first and swapped in atomically, so the index at path is
+// left as it was if anything fails. Processes that have the old index open keep
+// reading it until they load path again. Fails if an Indexer has path open.
+func Restore(r io.Reader, path string) error {
+	if err := checkNotWriting(path); err != nil {
+		return err
+	}
+
+	return writeAtomic(path, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	}, true)
+}
@@ -18,5 +18,25 @@ const (
 	TitleMagnitude
 	TitleMaxTf
 	PageRank
+	PageLength
+	TitleLength
+	CollectionStats
+	PageText
+	CrawlState
+	CrawlQueue
+	Fingerprint
+	FingerprintBands
+	Duplicates
+	TermBounds
+	TitleTermBounds
+	HostIndex
+	ClusterMembers
 	NumTable
 )
+
+// Keys of the CollectionStats table
+const (
+	AvgPageLength = iota
+	AvgTitleLength
+	CanonicalUrls
+)
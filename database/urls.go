@@ -0,0 +1,146 @@
+package database
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/rsmohamad/comp4321/models"
+)
+
+// Indexes written before URLs were canonicalised have them in the old form.
+// CanonicaliseUrls re-keys them once, which CollectionStats records under CanonicalUrls.
+
+// Returns the canonical form of url, or the url itself if it has none
+func canonicalOrSelf(canonical func(string) string, url string) string {
+	if rv := canonical(url); rv != "" {
+		return rv
+	}
+	return url
+}
+
+// Re-key the pages, their links and the frontier by the canonical form of their URLs,
+// unless it was already done. Pages whose URL has the same canonical form as another
+// indexed page are deleted. canonical returns "" for URLs without a canonical form,
+// which are kept as they are.
+// Returns the number of re-keyed URLs and of deleted pages.
+func (i *Indexer) CanonicaliseUrls(canonical func(string) string) (rekeyed, removed int) {
+	done := false
+	renames := make(map[string]string)
+	duplicates := make([]string, 0)
+	i.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(intToByte(CollectionStats)).Get(intToByte(CanonicalUrls)) != nil {
+			done = true
+			return nil
+		}
+
+		urlToId := tx.Bucket(intToByte(UrlToPageId))
+		taken := make(map[string]bool)
+		urlToId.ForEach(func(url, _ []byte) error {
+			if canonicalOrSelf(canonical, string(url)) == string(url) {
+				taken[string(url)] = true
+			}
+			return nil
+		})
+		urlToId.ForEach(func(url, _ []byte) error {
+			newUrl := canonicalOrSelf(canonical, string(url))
+			if newUrl == string(url) {
+				return nil
+			}
+			if taken[newUrl] {
+				duplicates = append(duplicates, string(url))
+				return nil
+			}
+			taken[newUrl] = true
+			renames[string(url)] = newUrl
+			return nil
+		})
+		return nil
+	})
+	if done {
+		return
+	}
+
+	for _, url := range duplicates {
+		if i.DeletePage(url) {
+			removed++
+		}
+	}
+
+	i.idLock.Lock()
+	defer i.idLock.Unlock()
+	i.db.Update(func(tx *bolt.Tx) error {
+		urlToId := tx.Bucket(intToByte(UrlToPageId))
+		idToUrl := tx.Bucket(intToByte(PageIdToUrl))
+		for url, newUrl := range renames {
+			pageId := append([]byte(nil), urlToId.Get([]byte(url))...)
+			deleteHost(tx, url, pageId)
+			urlToId.Delete([]byte(url))
+			urlToId.Put([]byte(newUrl), pageId)
+			idToUrl.Put(pageId, []byte(newUrl))
+			putHost(tx, newUrl, pageId)
+		}
+		rekeyed = len(renames)
+
+		// Links are looked up by URL when the adjacency list is built
+		pageInfo := tx.Bucket(intToByte(PageInfo))
+		docs := make(map[string]*models.Document)
+		pageInfo.ForEach(func(pageId, val []byte) error {
+			doc := byteToDoc(val)
+			doc.Uri = canonicalOrSelf(canonical, doc.Uri)
+			for j, link := range doc.Links {
+				doc.Links[j] = canonicalOrSelf(canonical, link)
+			}
+			docs[string(pageId)] = doc
+			return nil
+		})
+		for pageId, doc := range docs {
+			pageInfo.Put([]byte(pageId), docToByte(doc))
+		}
+
+		canonicaliseFrontier(tx, canonical)
+		tx.Bucket(intToByte(CollectionStats)).Put(intToByte(CanonicalUrls), []byte{1})
+		return nil
+	})
+	return
+}
+
+// Re-key the crawl states and queued URLs.
+// Of URLs with the same canonical form, the state of the first one is kept.
+func canonicaliseFrontier(tx *bolt.Tx, canonical func(string) string) {
+	states := tx.Bucket(intToByte(CrawlState))
+	renamed := make(map[string][]byte)
+	stale := make([]string, 0)
+	states.ForEach(func(url, val []byte) error {
+		newUrl := canonicalOrSelf(canonical, string(url))
+		if newUrl != string(url) {
+			stale = append(stale, string(url))
+			if states.Get([]byte(newUrl)) == nil && renamed[newUrl] == nil {
+				renamed[newUrl] = append([]byte(nil), val...)
+			}
+		}
+		return nil
+	})
+	for _, url := range stale {
+		states.Delete([]byte(url))
+	}
+	for url, val := range renamed {
+		states.Put([]byte(url), val)
+	}
+
+	// Queued URLs whose canonical form was already queued are dequeued
+	queue := tx.Bucket(intToByte(CrawlQueue))
+	queued := make(map[string]bool)
+	keys := make([][]byte, 0)
+	urls := make([]string, 0)
+	queue.ForEach(func(key, val []byte) error {
+		keys = append(keys, append([]byte(nil), key...))
+		urls = append(urls, canonicalOrSelf(canonical, string(val)))
+		return nil
+	})
+	for j, key := range keys {
+		if queued[urls[j]] {
+			queue.Delete(key)
+			continue
+		}
+		queued[urls[j]] = true
+		queue.Put(key, []byte(urls[j]))
+	}
+}
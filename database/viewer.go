@@ -4,9 +4,8 @@ import (
 	"github.com/rsmohamad/comp4321/models"
 
 	"github.com/boltdb/bolt"
+	"os"
 	"sort"
-	"strconv"
-	"strings"
 )
 
 // Class for reading the database
@@ -15,14 +14,25 @@ type Viewer struct {
 	db *bolt.DB
 }
 
-// Load a Viewer object from .db file
+// Load a Viewer object from .db file.
+// Returns an error if the file does not exist or lacks the tables of an index.
+// Use Verify to check the whole file.
 func LoadViewer(filename string) (*Viewer, error) {
+	// Opening creates missing files
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+
 	var viewer Viewer
 	var err error
 	viewer.db, err = bolt.Open(filename, 0666, &bolt.Options{ReadOnly: true})
 	if err != nil {
 		return nil, err
 	}
+	if err = viewer.db.View(checkTables); err != nil {
+		viewer.db.Close()
+		return nil, err
+	}
 	return &viewer, nil
 }
 
@@ -87,6 +97,29 @@ func (v *Viewer) ContainsWord(word string) bool {
 	return v.containsKey(word, WordToWordId)
 }
 
+// Returns a list of page IDs containing a word only in the title or only in the body
+func (v *Viewer) GetContainingPagesIn(word string, title bool) []uint64 {
+	rv := make([]uint64, 0)
+	wordId := v.wordToId(word)
+	if wordId == nil {
+		return rv
+	}
+
+	tablename := intToByte(InvertedTable)
+	if title {
+		tablename = intToByte(InvertedTableTitle)
+	}
+
+	v.db.View(func(tx *bolt.Tx) error {
+		// Postings are sorted by page ID
+		for _, p := range getPostings(tx.Bucket(tablename), wordId) {
+			rv = append(rv, p.pageId)
+		}
+		return nil
+	})
+	return rv
+}
+
 // Returns a list of page IDs containing a word
 func (v *Viewer) GetContainingPages(word string) []uint64 {
 	rv := make([]uint64, 0)
@@ -96,25 +129,11 @@ func (v *Viewer) GetContainingPages(word string) []uint64 {
 		return rv
 	}
 	v.db.View(func(tx *bolt.Tx) error {
-		wordBucket := tx.Bucket(intToByte(InvertedTable))
-		wordBucketTitle := tx.Bucket(intToByte(InvertedTableTitle))
-		docBucket := wordBucket.Bucket(wordId)
-		docBucketTitle := wordBucketTitle.Bucket(wordId)
-
-		if docBucket != nil {
-			docBucket.ForEach(func(k, v []byte) error {
-				set[byteToUint64(k)] = true
-				return nil
-			})
-		}
-
-		if docBucketTitle != nil {
-			docBucketTitle.ForEach(func(k, v []byte) error {
-				set[byteToUint64(k)] = true
-				return nil
-			})
+		for _, table := range []int{InvertedTable, InvertedTableTitle} {
+			for _, p := range getPostings(tx.Bucket(intToByte(table)), wordId) {
+				set[p.pageId] = true
+			}
 		}
-
 		return nil
 	})
 
@@ -129,6 +148,37 @@ func (v *Viewer) GetContainingPages(word string) []uint64 {
 	return rv
 }
 
+// Returns the IDs of all pages in ascending order
+func (v *Viewer) GetPageIds() []uint64 {
+	rv := make([]uint64, 0)
+	v.db.View(func(tx *bolt.Tx) error {
+		pages := tx.Bucket(intToByte(PageIdToUrl))
+		pages.ForEach(func(pageId, _ []byte) error {
+			rv = append(rv, byteToUint64(pageId))
+			return nil
+		})
+		return nil
+	})
+	return rv
+}
+
+// Returns the IDs of pages whose URL satisfies match, in ascending order.
+// Scans the URL of every page; GetPageIdsByHost finds the pages of a host from an index.
+func (v *Viewer) GetPageIdsByUrl(match func(url string) bool) []uint64 {
+	rv := make([]uint64, 0)
+	v.db.View(func(tx *bolt.Tx) error {
+		pages := tx.Bucket(intToByte(PageIdToUrl))
+		pages.ForEach(func(pageId, url []byte) error {
+			if match(string(url)) {
+				rv = append(rv, byteToUint64(pageId))
+			}
+			return nil
+		})
+		return nil
+	})
+	return rv
+}
+
 // Returns a document object from a pageId.
 // Returns nil if the pageId does not exist
 func (v *Viewer) GetDocument(pageId uint64) (document *models.Document) {
@@ -199,6 +249,26 @@ func (v *Viewer) GetPageRank(pageId uint64) float64 {
 	return rv
 }
 
+// Returns the representative of each page that is a near duplicate of another page.
+// Pages that are not in the map are their own representative.
+func (v *Viewer) GetRepresentatives(pageIds []uint64) map[uint64]uint64 {
+	rv := make(map[uint64]uint64)
+	v.db.View(func(tx *bolt.Tx) error {
+		duplicates := tx.Bucket(intToByte(Duplicates))
+		if duplicates == nil {
+			return nil
+		}
+
+		for _, id := range pageIds {
+			if res := duplicates.Get(uint64ToByte(id)); res != nil {
+				rv[id] = byteToUint64(res)
+			}
+		}
+		return nil
+	})
+	return rv
+}
+
 // Return the positions of a word in a document.
 // If the word does not exist in the inverted table, returns an empty slice.
 func (v *Viewer) GetPositionIndices(docId uint64, word string, title bool) []uint64 {
@@ -215,26 +285,180 @@ func (v *Viewer) GetPositionIndices(docId uint64, word string, title bool) []uin
 	}
 
 	v.db.View(func(tx *bolt.Tx) error {
-		inv := tx.Bucket(tablename)
-		docs := inv.Bucket(wordId)
-		if docs == nil {
-			return nil
+		postings := getPostings(tx.Bucket(tablename), wordId)
+		if i := findPosting(postings, docId); i >= 0 {
+			for _, pos := range postings[i].positions {
+				rv = append(rv, uint64(pos))
+			}
 		}
+		return nil
+	})
 
-		indices := docs.Get(uint64ToByte(docId))
-		if indices == nil {
-			return nil
+	return rv
+}
+
+// Returns the positions of a word in each document containing it.
+// Reads the posting list once, unlike GetPositionIndices.
+func (v *Viewer) GetPositions(word string, title bool) map[uint64][]uint64 {
+	rv := make(map[uint64][]uint64)
+
+	tablename := intToByte(InvertedTable)
+	if title {
+		tablename = intToByte(InvertedTableTitle)
+	}
+
+	wordId := v.wordToId(word)
+	if wordId == nil {
+		return rv
+	}
+
+	v.db.View(func(tx *bolt.Tx) error {
+		for _, p := range getPostings(tx.Bucket(tablename), wordId) {
+			positions := make([]uint64, len(p.positions))
+			for i, pos := range p.positions {
+				positions[i] = uint64(pos)
+			}
+			rv[p.pageId] = positions
 		}
+		return nil
+	})
+	return rv
+}
+
+// Posting of a word in a page.
+// Weight is the tf-idf weight computed by UpdateTermWeights.
+type Posting struct {
+	PageId uint64
+	Tf     int
+	Weight float64
+}
+
+// Upper bounds of the scores of a word in a field, computed by UpdateTermWeights.
+// Cosine is the largest weight of the word divided by the magnitude of its page.
+// MaxTf and MinLength are the largest term frequency and the shortest page containing the word.
+type TermBound struct {
+	Cosine           float64
+	MaxTf, MinLength int
+}
+
+// Statistics of a page used to score queries
+type PageStats struct {
+	Magnitude, TitleMagnitude float64
+	Length, TitleLength       int
+}
+
+// Postings and statistics needed to score a query, see ScanQuery
+type QueryIndex struct {
+	NumPages                  int
+	AvgLength, AvgTitleLength float64
+
+	// Postings of each query word in the body and the title, sorted by page ID
+	Body, Title map[string][]Posting
+
+	// Bounds of the query words that have them
+	BodyBounds, TitleBounds map[string]TermBound
 
-		indicesArr := strings.Split(string(indices), ",")
-		for _, indexStr := range indicesArr {
-			index, _ := strconv.Atoi(indexStr)
-			rv = append(rv, uint64(index))
+	Pages map[uint64]PageStats
+}
+
+// Calls fn with the postings of the words and a function returning the statistics of a page.
+// Everything is read in a single transaction, and each posting list only once.
+// The stats function must not be used after fn returns.
+func (v *Viewer) ScanQuery(words []string, fn func(index *QueryIndex, stats func(pageId uint64) PageStats)) {
+	index := &QueryIndex{
+		Body:        make(map[string][]Posting),
+		Title:       make(map[string][]Posting),
+		BodyBounds:  make(map[string]TermBound),
+		TitleBounds: make(map[string]TermBound),
+		Pages:       make(map[uint64]PageStats),
+	}
+
+	v.db.View(func(tx *bolt.Tx) error {
+		wordToId := tx.Bucket(intToByte(WordToWordId))
+		readPostings := func(table int, wordId []byte) []Posting {
+			inverted := tx.Bucket(intToByte(table))
+			var postings []posting
+			if val := inverted.Get(wordId); val != nil {
+				postings = decodePostings(val, false)
+			} else {
+				postings = getPostings(inverted, wordId)
+			}
+
+			list := make([]Posting, len(postings))
+			for i, p := range postings {
+				list[i] = Posting{p.pageId, p.tf, p.weight}
+			}
+			return list
+		}
+		readBound := func(table int, wordId []byte, word string, bounds map[string]TermBound) {
+			if bucket := tx.Bucket(intToByte(table)); bucket != nil {
+				if val := bucket.Get(wordId); val != nil {
+					bounds[word] = byteToTermBound(val)
+				}
+			}
+		}
+
+		for _, word := range words {
+			if _, read := index.Body[word]; read {
+				continue
+			}
+			wordId := wordToId.Get([]byte(word))
+			if wordId == nil {
+				index.Body[word], index.Title[word] = nil, nil
+				continue
+			}
+			index.Body[word] = readPostings(InvertedTable, wordId)
+			index.Title[word] = readPostings(InvertedTableTitle, wordId)
+			readBound(TermBounds, wordId, word, index.BodyBounds)
+			readBound(TitleTermBounds, wordId, word, index.TitleBounds)
+		}
+
+		index.NumPages = tx.Bucket(intToByte(PageIdToUrl)).Stats().KeyN
+		if stats := tx.Bucket(intToByte(CollectionStats)); stats != nil {
+			if val := stats.Get(intToByte(AvgPageLength)); val != nil {
+				index.AvgLength = byteToFloat64(val)
+			}
+			if val := stats.Get(intToByte(AvgTitleLength)); val != nil {
+				index.AvgTitleLength = byteToFloat64(val)
+			}
+		}
+
+		getFloat := func(table int, key []byte) float64 {
+			if val := tx.Bucket(intToByte(table)).Get(key); val != nil {
+				return byteToFloat64(val)
+			}
+			return 0
+		}
+		getInt := func(table int, key []byte) int {
+			if bucket := tx.Bucket(intToByte(table)); bucket != nil {
+				if val := bucket.Get(key); val != nil {
+					return byteToInt(val)
+				}
+			}
+			return 0
 		}
+		fn(index, func(pageId uint64) PageStats {
+			key := uint64ToByte(pageId)
+			return PageStats{
+				Magnitude:      getFloat(PageMagnitude, key),
+				TitleMagnitude: getFloat(TitleMagnitude, key),
+				Length:         getInt(PageLength, key),
+				TitleLength:    getInt(TitleLength, key),
+			}
+		})
 		return nil
 	})
+}
 
-	return rv
+// Returns the postings of the words and the statistics of the pages, see ScanQuery
+func (v *Viewer) GetQueryIndex(words []string, pageIds []uint64) (rv *QueryIndex) {
+	v.ScanQuery(words, func(index *QueryIndex, stats func(pageId uint64) PageStats) {
+		for _, id := range pageIds {
+			index.Pages[id] = stats(id)
+		}
+		rv = index
+	})
+	return
 }
 
 // Iterate over all documents
@@ -301,6 +525,104 @@ func (v *Viewer) GetTfIdf(docId uint64, word string, title bool) (rv float64) {
 	return
 }
 
+// Returns the term frequency of a word in a document
+func (v *Viewer) GetTf(docId uint64, word string, title bool) (rv int) {
+	wordId := v.wordToId(word)
+	if wordId == nil {
+		return 0
+	}
+
+	tablename := intToByte(ForwardTable)
+	if title {
+		tablename = intToByte(ForwardTableTitle)
+	}
+
+	v.db.View(func(tx *bolt.Tx) error {
+		words := tx.Bucket(tablename).Bucket(uint64ToByte(docId))
+		if words == nil {
+			return nil
+		}
+
+		val := words.Get(wordId)
+		if val != nil {
+			rv = byteToInt(val)
+		}
+		return nil
+	})
+	return
+}
+
+// Returns the cleaned body text of a document.
+// Returns an empty string if no text is stored.
+func (v *Viewer) GetText(docId uint64) (rv string) {
+	v.db.View(func(tx *bolt.Tx) error {
+		texts := tx.Bucket(intToByte(PageText))
+		if texts == nil {
+			return nil
+		}
+
+		val := texts.Get(uint64ToByte(docId))
+		if val != nil {
+			rv = byteToText(val)
+		}
+		return nil
+	})
+	return
+}
+
+// Returns the number of terms in a document
+func (v *Viewer) GetLength(docId uint64, title bool) (rv int) {
+	tablename := intToByte(PageLength)
+	if title {
+		tablename = intToByte(TitleLength)
+	}
+
+	v.db.View(func(tx *bolt.Tx) error {
+		lengths := tx.Bucket(tablename)
+		if lengths == nil {
+			return nil
+		}
+
+		val := lengths.Get(uint64ToByte(docId))
+		if val != nil {
+			rv = byteToInt(val)
+		}
+		return nil
+	})
+	return
+}
+
+// Returns the average number of terms in a document over the collection
+func (v *Viewer) GetAverageLength(title bool) (rv float64) {
+	key := intToByte(AvgPageLength)
+	if title {
+		key = intToByte(AvgTitleLength)
+	}
+
+	v.db.View(func(tx *bolt.Tx) error {
+		stats := tx.Bucket(intToByte(CollectionStats))
+		if stats == nil {
+			return nil
+		}
+
+		val := stats.Get(key)
+		if val != nil {
+			rv = byteToFloat64(val)
+		}
+		return nil
+	})
+	return
+}
+
+// Returns the number of pages in the database
+func (v *Viewer) GetNumPages() (rv int) {
+	v.db.View(func(tx *bolt.Tx) error {
+		rv = tx.Bucket(intToByte(PageIdToUrl)).Stats().KeyN
+		return nil
+	})
+	return
+}
+
 func (v *Viewer) GetKeywords() []string {
 	rv := make([]string, 0)
 	v.db.View(func(tx *bolt.Tx) error {
@@ -0,0 +1,65 @@
+package models
+
+// State of a URL in the crawl frontier
+type CrawlStatus int
+
+const (
+	Queued CrawlStatus = iota
+	InFlight
+	Fetched
+	Failed
+
+	// Refused by a limit of the crawl, such as the page limit of its host.
+	// A resumed crawl queues it again.
+	Skipped
+)
+
+func (s CrawlStatus) String() string {
+	switch s {
+	case Queued:
+		return "queued"
+	case InFlight:
+		return "in-flight"
+	case Fetched:
+		return "fetched"
+	case Failed:
+		return "failed"
+	case Skipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// Only exported fields are serialized.
+// Reason is only set for failed and skipped URLs.
+// Depth is the number of links followed from the seed.
+type CrawlState struct {
+	Status CrawlStatus
+	Reason string
+	Time   int64
+	Depth  int
+
+	// Order in the queue, from a sitemap or the default ones
+	Priority float64
+	Lastmod  int64
+
+	// Starting page of the crawl, kept so that a resumed crawl has the same scope
+	Seed bool
+
+	// Key of the URL in the crawl queue while it is queued
+	QueueKey []byte
+
+	// URL that redirected to this one when it was fetched.
+	// The fetch counts toward the page limit of the host of that URL only.
+	RedirectedFrom string
+}
+
+// URL to add to the crawl queue.
+// Priority is between 0 and 1, and Lastmod is a unix time or 0 if unknown.
+type QueuedUrl struct {
+	Url      string
+	Depth    int
+	Priority float64
+	Lastmod  int64
+	Seed     bool
+}
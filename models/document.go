@@ -22,6 +22,13 @@ type Document struct {
 	MaxTf      int
 	TitleMaxTf int
 	Modtime    int64
+	ETag       string
+
+	// Cleaned body text, stored apart from the rest of the document
+	Text string
+
+	// SimHash of the body words, see simhash.go
+	Fingerprint uint64
 }
 
 func (d Document) GetSizeStr() string {
@@ -6,21 +6,32 @@ import (
 )
 
 type kw struct {
-	Word string
-	Tf   int
+	Word string `json:"word"`
+	Tf   int    `json:"tf"`
+}
+
+// Part of a snippet, Match is set for words matching the query
+type SnippetFragment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
 }
 
 // Class for presenting the search results.
 type DocumentView struct {
-	Title    string
-	Uri      string
-	Date     string
-	Size     string
-	Parents  []string
-	Children []string
-	Keywords []kw
-	Tf       []int
-	Score    float64
+	Id       uint64            `json:"id"`
+	Title    string            `json:"title"`
+	Uri      string            `json:"uri"`
+	Date     string            `json:"date"`
+	Size     string            `json:"size"`
+	Parents  []string          `json:"parents"`
+	Children []string          `json:"children"`
+	Keywords []kw              `json:"keywords"`
+	Snippet  []SnippetFragment `json:"snippet"`
+	Tf       []int             `json:"-"`
+	Score    float64           `json:"score"`
+
+	// Number of near duplicates left out of the results
+	Similar int `json:"similar"`
 }
 
 func NewDocumentView(d *Document) *DocumentView {
@@ -1,7 +1,57 @@
 package models
 
+import (
+	"net/url"
+	"strconv"
+)
+
 type ResultView struct {
-	Query        string
-	Results      []*DocumentView
-	TotalResults int
+	Query        string          `json:"query"`
+	Results      []*DocumentView `json:"results"`
+	TotalResults int             `json:"totalResults"`
+	Page         int             `json:"page"`
+	PageSize     int             `json:"pageSize"`
+	Field        string          `json:"field,omitempty"`
+	Site         string          `json:"site,omitempty"`
+	Model        string          `json:"model"`
+	PrevLink     string          `json:"prev,omitempty"`
+	NextLink     string          `json:"next,omitempty"`
+}
+
+// Index of the first result on the current page, counted from 1
+func (r ResultView) GetFirstIndex() int {
+	if len(r.Results) == 0 {
+		return 0
+	}
+	return (r.Page-1)*r.PageSize + 1
+}
+
+// Index of the last result on the current page, counted from 1
+func (r ResultView) GetLastIndex() int {
+	if len(r.Results) == 0 {
+		return 0
+	}
+	return (r.Page-1)*r.PageSize + len(r.Results)
+}
+
+// Set the links to the previous and next pages.
+// The links keep the query string of u with the page number replaced.
+func (r *ResultView) SetPageLinks(u *url.URL) {
+	linkTo := func(page int) string {
+		link := *u
+		values := link.Query()
+		values.Set("page", strconv.Itoa(page))
+		link.RawQuery = values.Encode()
+		return link.RequestURI()
+	}
+
+	r.PrevLink = ""
+	r.NextLink = ""
+	if r.Page > 1 {
+		r.PrevLink = linkTo(r.Page - 1)
+	}
+	// Same as Page*PageSize < TotalResults, without overflowing
+	if r.Page > 0 && r.PageSize > 0 && r.Page <= (r.TotalResults-1)/r.PageSize {
+		r.NextLink = linkTo(r.Page + 1)
+	}
 }
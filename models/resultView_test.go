@@ -0,0 +1,36 @@
+package models
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestResultView_SetPageLinks(t *testing.T) {
+	u, _ := url.Parse("/search/?keywords=hkust&page=2")
+	rv := ResultView{TotalResults: 25, Page: 2, PageSize: 10}
+	rv.Results = make([]*DocumentView, 10)
+	rv.SetPageLinks(u)
+
+	if rv.PrevLink != "/search/?keywords=hkust&page=1" || rv.NextLink != "/search/?keywords=hkust&page=3" {
+		t.Log(rv.PrevLink, rv.NextLink)
+		t.Fail()
+	}
+
+	if rv.GetFirstIndex() != 11 || rv.GetLastIndex() != 20 {
+		t.Fail()
+	}
+
+	rv.Page = 3
+	rv.Results = make([]*DocumentView, 5)
+	rv.SetPageLinks(u)
+	if rv.NextLink != "" || rv.GetLastIndex() != 25 {
+		t.Fail()
+	}
+
+	rv.Page = 1 << 62
+	rv.PageSize = 4
+	rv.SetPageLinks(u)
+	if rv.NextLink != "" {
+		t.Fail()
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"hash/fnv"
+	"strings"
+)
+
+// Number of consecutive words hashed together
+const shingleSize = 3
+
+// Returns the 64-bit SimHash of the words.
+// Pages with similar content have fingerprints that differ in few bits.
+// Returns 0 if there are no words.
+func SimHash(words []string) uint64 {
+	if len(words) == 0 {
+		return 0
+	}
+
+	size := shingleSize
+	if len(words) < size {
+		size = len(words)
+	}
+
+	// Every shingle votes for the bits of its hash
+	var votes [64]int
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+size], " ")))
+		hash := h.Sum64()
+		for bit := uint(0); bit < 64; bit++ {
+			if hash&(1<<bit) != 0 {
+				votes[bit]++
+			} else {
+				votes[bit]--
+			}
+		}
+	}
+
+	var rv uint64
+	for bit := uint(0); bit < 64; bit++ {
+		if votes[bit] > 0 {
+			rv |= 1 << bit
+		}
+	}
+	return rv
+}
+
+// Returns the number of bits in which the fingerprints differ
+func HammingDistance(a, b uint64) (rv int) {
+	for x := a ^ b; x != 0; x &= x - 1 {
+		rv++
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSimHash(t *testing.T) {
+	text := "the quick brown fox jumps over the lazy dog while the cat sleeps in the warm sun " +
+		"and the birds sing in the tall trees near the quiet river bank on a long summer afternoon"
+	words := strings.Fields(text)
+	similar := strings.Fields(strings.Replace(text, "lazy", "sleepy", 1))
+	different := strings.Fields("search engines crawl the web and index pages by their words and links")
+
+	if SimHash(words) != SimHash(strings.Fields(text)) {
+		t.Error("Expected equal fingerprints for equal words")
+	}
+	if d := HammingDistance(SimHash(words), SimHash(similar)); d > 10 {
+		t.Error("Expected close fingerprints for similar words, distance", d)
+	}
+	if d := HammingDistance(SimHash(words), SimHash(different)); d < 10 {
+		t.Error("Expected distant fingerprints for different words, distance", d)
+	}
+	if SimHash(nil) != 0 {
+		t.Error("Expected 0 for no words")
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	if HammingDistance(0, 0) != 0 || HammingDistance(0, 7) != 3 || HammingDistance(^uint64(0), 0) != 64 {
+		t.Error("Wrong hamming distance")
+	}
+}
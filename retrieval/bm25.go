@@ -0,0 +1,80 @@
+package retrieval
+
+import (
+	"github.com/rsmohamad/comp4321/database"
+	"math"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Length normalised term frequency of a field
+func normalisedTf(tf, length int, avgLength float64) float64 {
+	if avgLength == 0 {
+		return float64(tf)
+	}
+	return float64(tf) / (1 - bm25B + bm25B*float64(length)/avgLength)
+}
+
+func bm25Idf(numPages, df int) float64 {
+	return math.Log(1 + (float64(numPages)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// Returns the number of distinct pages in two posting lists sorted by page ID
+func countPages(body, title []database.Posting) int {
+	count, i, j := 0, 0, 0
+	for i < len(body) || j < len(title) {
+		if j == len(title) || (i < len(body) && body[i].PageId < title[j].PageId) {
+			i++
+		} else if i == len(body) || title[j].PageId < body[i].PageId {
+			j++
+		} else {
+			i++
+			j++
+		}
+		count++
+	}
+	return count
+}
+
+// Returns BM25 scores of the documents, or BM25F scores if titleWeight is not zero.
+// With BM25F, the term frequencies of the title are weighted and added to the body's.
+// Documents are scored term at a time.
+func getBM25Scores(query []string, viewer *database.Viewer, docsToSearch []uint64, titleWeight float64) (map[uint64]float64, []uint64) {
+	documentScores, documentIds := candidateDocuments(docsToSearch)
+	index := viewer.GetQueryIndex(query, documentIds)
+
+	for _, word := range query {
+		// BM25F counts a page towards the df if either field contains the word
+		df := len(index.Body[word])
+		if titleWeight != 0 {
+			df = countPages(index.Body[word], index.Title[word])
+		}
+		idf := bm25Idf(index.NumPages, df)
+
+		tfs := make(map[uint64]float64)
+		for _, p := range index.Body[word] {
+			if stats, found := index.Pages[p.PageId]; found {
+				tfs[p.PageId] += normalisedTf(p.Tf, stats.Length, index.AvgLength)
+			}
+		}
+		if titleWeight != 0 {
+			for _, p := range index.Title[word] {
+				if stats, found := index.Pages[p.PageId]; found {
+					tfs[p.PageId] += titleWeight * normalisedTf(p.Tf, stats.TitleLength, index.AvgTitleLength)
+				}
+			}
+		}
+
+		for id, tf := range tfs {
+			if tf > 0 {
+				documentScores[id] += idf * tf * (bm25K1 + 1) / (tf + bm25K1)
+			}
+		}
+	}
+
+	return documentScores, documentIds
+}
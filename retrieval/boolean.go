@@ -23,14 +23,74 @@ func intersect(list1, list2 []uint64) (answer []uint64) {
 	return
 }
 
+func union(list1, list2 []uint64) (answer []uint64) {
+	i := 0
+	j := 0
+
+	for i != len(list1) || j != len(list2) {
+		if j == len(list2) || (i != len(list1) && list1[i] < list2[j]) {
+			answer = append(answer, list1[i])
+			i++
+		} else if i == len(list1) || list2[j] < list1[i] {
+			answer = append(answer, list2[j])
+			j++
+		} else {
+			answer = append(answer, list1[i])
+			i++
+			j++
+		}
+	}
+	return
+}
+
+// Returns the elements of list1 that are not in list2
+func difference(list1, list2 []uint64) (answer []uint64) {
+	i := 0
+	j := 0
+
+	for i != len(list1) {
+		if j == len(list2) || list1[i] < list2[j] {
+			answer = append(answer, list1[i])
+			i++
+		} else if list1[i] == list2[j] {
+			i++
+			j++
+		} else {
+			j++
+		}
+	}
+	return
+}
+
+// Part of a page that a word is searched in
+type searchField int
+
+const (
+	anyField searchField = iota
+	titleField
+	bodyField
+)
+
 func booleanFilter(query []string, viewer *database.Viewer) (docIDs []uint64) {
+	return booleanFilterIn(query, viewer, anyField)
+}
+
+// Returns the pages containing all words of the query in the given field
+func booleanFilterIn(query []string, viewer *database.Viewer, field searchField) (docIDs []uint64) {
 	if len(query) == 0 {
 		return
 	}
 
 	wordDoc := make(map[string][]uint64)
 	for _, word := range query {
-		wordDoc[word] = viewer.GetContainingPages(word)
+		switch field {
+		case titleField:
+			wordDoc[word] = viewer.GetContainingPagesIn(word, true)
+		case bodyField:
+			wordDoc[word] = viewer.GetContainingPagesIn(word, false)
+		default:
+			wordDoc[word] = viewer.GetContainingPages(word)
+		}
 	}
 
 	sort.Slice(query, func(i, j int) bool {
@@ -19,26 +19,38 @@ func splitToBigrams(query []string) (bigrams []Bigram) {
 	return
 }
 
-func hasBigram(id uint64, bigram Bigram, viewer *database.Viewer, title bool) bool {
-	pos1 := viewer.GetPositionIndices(id, bigram.n1, title)
-	pos2 := viewer.GetPositionIndices(id, bigram.n2, title)
-
-	for i := range pos2 {
-		pos2[i]--
+// Returns true if a position in pos2 directly follows a position in pos1
+func hasBigram(pos1, pos2 []uint64) bool {
+	shifted := make([]uint64, 0, len(pos2))
+	for _, pos := range pos2 {
+		if pos > 0 {
+			shifted = append(shifted, pos-1)
+		}
 	}
 
-	common := intersect(pos1, pos2)
+	common := intersect(pos1, shifted)
 	return len(common) > 0
 }
 
-// Returns docIds that contain the bigram phrase.
-func hasPhrase(bigram Bigram, viewer *database.Viewer) []uint64 {
-	docIds := booleanFilter([]string{bigram.n1, bigram.n2}, viewer)
+// Returns docIds that contain the bigram phrase in the given field.
+// The positions of each word are read once per field.
+func hasPhrase(bigram Bigram, viewer *database.Viewer, field searchField) []uint64 {
+	docIds := booleanFilterIn([]string{bigram.n1, bigram.n2}, viewer, field)
 	rv := make([]uint64, 0)
 
+	var body1, body2, title1, title2 map[uint64][]uint64
+	if field != titleField {
+		body1 = viewer.GetPositions(bigram.n1, false)
+		body2 = viewer.GetPositions(bigram.n2, false)
+	}
+	if field != bodyField {
+		title1 = viewer.GetPositions(bigram.n1, true)
+		title2 = viewer.GetPositions(bigram.n2, true)
+	}
+
 	for _, id := range docIds {
-		inBody := hasBigram(id, bigram, viewer, false)
-		inTitle := hasBigram(id, bigram, viewer, true)
+		inBody := field != titleField && hasBigram(body1[id], body2[id])
+		inTitle := field != bodyField && hasBigram(title1[id], title2[id])
 
 		if inBody || inTitle {
 			rv = append(rv, id)
@@ -51,8 +63,13 @@ func hasPhrase(bigram Bigram, viewer *database.Viewer) []uint64 {
 // Treat the query as a phrase and returns docIds containing the phrase.
 // Changes the query into bigrams and find documents containing all bigrams.
 func filterPhrase(query []string, viewer *database.Viewer) []uint64 {
+	return filterPhraseIn(query, viewer, anyField)
+}
+
+// Returns docIds containing the phrase in the given field.
+func filterPhraseIn(query []string, viewer *database.Viewer, field searchField) []uint64 {
 	if len(query) <= 1 {
-		return booleanFilter(query, viewer)
+		return booleanFilterIn(query, viewer, field)
 	}
 
 	bigrams := splitToBigrams(query)
@@ -60,7 +77,7 @@ func filterPhrase(query []string, viewer *database.Viewer) []uint64 {
 	docWithBigrams := make([][]uint64, 0)
 
 	for _, bigram := range bigrams {
-		docWithBigrams = append(docWithBigrams, hasPhrase(bigram, viewer))
+		docWithBigrams = append(docWithBigrams, hasPhrase(bigram, viewer, field))
 	}
 
 	sort.Slice(docWithBigrams, func(i, j int) bool {
@@ -79,7 +96,7 @@ func filterPhrase(query []string, viewer *database.Viewer) []uint64 {
 	return docIDs
 }
 
-func retrievePhrase(phrases []string, query string, viewer *database.Viewer) (map[uint64]float64, []uint64) {
+func retrievePhrase(phrases []string, query string, viewer *database.Viewer, opts Options) (map[uint64]float64, []uint64) {
 	docIds := make([]uint64, 0)
 	for _, phrase := range phrases {
 		preprocessed := preprocessText(phrase)
@@ -87,5 +104,5 @@ func retrievePhrase(phrases []string, query string, viewer *database.Viewer) (ma
 	}
 
 	preprocessed := preprocessText(query)
-	return getDocumentScores(preprocessed, viewer, docIds)
+	return scoreDocuments(preprocessed, viewer, docIds, opts)
 }
@@ -0,0 +1,408 @@
+package retrieval
+
+import (
+	"github.com/rsmohamad/comp4321/database"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Boolean query language.
+// Terms are implicitly joined by AND. Supports OR, NOT or -term,
+// parenthesized groups and quoted phrases, e.g.
+//   (cse OR engineering) -admission "final year project"
+//
+// Field operators restrict a term, phrase or group to the title or body,
+// and site: and inurl: restrict the results by URL, e.g.
+//   title:(cse OR engineering) body:"final year project" site:cse.ust.hk inurl:ug
+//
+// Grammar:
+//   expr    := andExpr ("OR" andExpr)*
+//   andExpr := unary (["AND"] unary)*
+//   unary   := ("NOT" | "-") unary | primary
+//   primary := ("title:" | "body:") primary | ("site:" | "inurl:") value
+//            | "(" expr ")" | phrase | term
+
+const (
+	opAnd    = "AND"
+	opOr     = "OR"
+	opNot    = "NOT"
+	opMinus  = "-"
+	opLParen = "("
+	opRParen = ")"
+
+	fieldTitle = "title"
+	fieldBody  = "body"
+	fieldSite  = "site"
+	fieldInUrl = "inurl"
+)
+
+// Fields that words can be restricted to
+var searchFields = map[string]searchField{
+	fieldTitle: titleField,
+	fieldBody:  bodyField,
+}
+
+// Shared state when evaluating a query tree
+type queryContext struct {
+	viewer   *database.Viewer
+	universe []uint64
+}
+
+// Returns all page IDs, loaded on first use
+func (c *queryContext) getUniverse() []uint64 {
+	if c.universe == nil {
+		c.universe = c.viewer.GetPageIds()
+	}
+	return c.universe
+}
+
+// Node of the query tree.
+// eval returns a sorted list of matching page IDs.
+type queryNode interface {
+	eval(ctx *queryContext) []uint64
+}
+
+type termNode struct {
+	words []string
+	field searchField
+}
+
+type phraseNode struct {
+	words []string
+	field searchField
+}
+
+// Matches pages by their URL.
+// Site nodes have the host, so that they are looked up in the host index.
+type urlNode struct {
+	match func(url string) bool
+	host  string
+}
+
+type notNode struct {
+	child queryNode
+}
+
+type andNode struct {
+	children []queryNode
+}
+
+type orNode struct {
+	children []queryNode
+}
+
+func (n *termNode) eval(ctx *queryContext) []uint64 {
+	words := append([]string{}, n.words...)
+	return booleanFilterIn(words, ctx.viewer, n.field)
+}
+
+func (n *phraseNode) eval(ctx *queryContext) []uint64 {
+	return filterPhraseIn(n.words, ctx.viewer, n.field)
+}
+
+func (n *urlNode) eval(ctx *queryContext) []uint64 {
+	if n.host != "" {
+		if ids, indexed := ctx.viewer.GetPageIdsByHost(n.host); indexed {
+			return ids
+		}
+	}
+	// Scans the URL of every page
+	return ctx.viewer.GetPageIdsByUrl(n.match)
+}
+
+// Matches pages on the host or any of its subdomains
+func newSiteNode(site string) *urlNode {
+	site = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(site), "http://"), "https://")
+	site = strings.TrimSuffix(site, "/")
+	match := func(uri string) bool {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(u.Hostname())
+		return host == site || strings.HasSuffix(host, "."+site)
+	}
+	return &urlNode{match: match, host: site}
+}
+
+// Matches pages whose URL contains the fragment.
+// Scans the URL of every page.
+func newInUrlNode(fragment string) *urlNode {
+	fragment = strings.ToLower(fragment)
+	return &urlNode{match: func(uri string) bool {
+		return strings.Contains(strings.ToLower(uri), fragment)
+	}}
+}
+
+// Split a token of the form field:value.
+// Returns false if the token does not start with a known field.
+func splitField(token string) (field, value string, ok bool) {
+	idx := strings.Index(token, ":")
+	if idx < 0 {
+		return "", "", false
+	}
+
+	field = token[:idx]
+	if _, isSearchField := searchFields[field]; !isSearchField && field != fieldSite && field != fieldInUrl {
+		return "", "", false
+	}
+	return field, token[idx+1:], true
+}
+
+func (n *notNode) eval(ctx *queryContext) []uint64 {
+	return difference(ctx.getUniverse(), n.child.eval(ctx))
+}
+
+// Intersects the positive children and subtracts the negated ones.
+// Subtracts from all pages if there are only negated children.
+func (n *andNode) eval(ctx *queryContext) []uint64 {
+	var rv []uint64
+	negated := make([]queryNode, 0)
+	first := true
+
+	for _, child := range n.children {
+		if not, ok := child.(*notNode); ok {
+			negated = append(negated, not.child)
+			continue
+		}
+
+		if first {
+			rv = child.eval(ctx)
+			first = false
+		} else {
+			rv = intersect(rv, child.eval(ctx))
+		}
+	}
+
+	if first {
+		rv = ctx.getUniverse()
+	}
+
+	for _, child := range negated {
+		rv = difference(rv, child.eval(ctx))
+	}
+	return rv
+}
+
+func (n *orNode) eval(ctx *queryContext) []uint64 {
+	rv := make([]uint64, 0)
+	for _, child := range n.children {
+		rv = union(rv, child.eval(ctx))
+	}
+	return rv
+}
+
+// Split a query into words, phrases, operators and parentheses.
+// Phrases keep their surrounding quotes.
+func tokenizeQuery(query string) []string {
+	tokens := make([]string, 0)
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		switch {
+		case unicode.IsSpace(char):
+			continue
+		case char == '(' || char == ')':
+			tokens = append(tokens, string(char))
+		case char == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			// Unterminated phrases extend to the end of the query
+			tokens = append(tokens, "\""+string(runes[i+1:end])+"\"")
+			i = end
+		case char == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, opMinus)
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()\"", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, string(runes[i:end]))
+			i = end - 1
+		}
+	}
+	return tokens
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+
+	// Words outside of negations, used for ranking
+	terms []string
+}
+
+func (p *queryParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *queryParser) parseExpr(negated bool, field searchField) queryNode {
+	children := make([]queryNode, 0)
+	for {
+		if child := p.parseAnd(negated, field); child != nil {
+			children = append(children, child)
+		}
+		if p.peek() != opOr {
+			break
+		}
+		p.next()
+	}
+
+	if len(children) == 0 {
+		return nil
+	} else if len(children) == 1 {
+		return children[0]
+	}
+	return &orNode{children}
+}
+
+func (p *queryParser) parseAnd(negated bool, field searchField) queryNode {
+	children := make([]queryNode, 0)
+	for p.pos < len(p.tokens) {
+		token := p.peek()
+		if token == opOr || token == opRParen {
+			break
+		}
+		if token == opAnd {
+			p.next()
+			continue
+		}
+		if child := p.parseUnary(negated, field); child != nil {
+			children = append(children, child)
+		}
+	}
+
+	if len(children) == 0 {
+		return nil
+	} else if len(children) == 1 {
+		return children[0]
+	}
+	return &andNode{children}
+}
+
+func (p *queryParser) parseUnary(negated bool, field searchField) queryNode {
+	token := p.peek()
+	if token == opNot || token == opMinus {
+		p.next()
+		child := p.parseUnary(!negated, field)
+		if child == nil {
+			return nil
+		}
+		return &notNode{child}
+	}
+	return p.parsePrimary(negated, field)
+}
+
+func (p *queryParser) parsePrimary(negated bool, field searchField) queryNode {
+	token := p.next()
+
+	if name, value, ok := splitField(token); ok {
+		switch name {
+		case fieldSite, fieldInUrl:
+			// The value may be quoted
+			if value == "" && strings.HasPrefix(p.peek(), "\"") {
+				value = strings.Trim(p.next(), "\"")
+			}
+			if value == "" {
+				return nil
+			} else if name == fieldSite {
+				return newSiteNode(value)
+			}
+			return newInUrlNode(value)
+		default:
+			// A field without value applies to the next phrase or group
+			if value == "" {
+				return p.parsePrimary(negated, searchFields[name])
+			}
+			token = value
+			field = searchFields[name]
+		}
+	}
+
+	switch {
+	case token == opLParen:
+		node := p.parseExpr(negated, field)
+		// Missing closing parenthesis is treated as end of query
+		if p.peek() == opRParen {
+			p.next()
+		}
+		return node
+	case token == "" || token == opRParen:
+		return nil
+	}
+
+	words := preprocessText(strings.Trim(token, "\""))
+	if len(words) == 0 {
+		return nil
+	}
+	if !negated {
+		p.terms = append(p.terms, words...)
+	}
+
+	if strings.HasPrefix(token, "\"") {
+		return &phraseNode{words, field}
+	}
+	return &termNode{words, field}
+}
+
+// Parse a boolean query into a query tree.
+// Also returns the words that are not negated, for ranking the results.
+// The tree is nil if the query has no searchable words.
+func parseQuery(query string) (queryNode, []string) {
+	parser := &queryParser{tokens: tokenizeQuery(query)}
+	var children []queryNode
+
+	// Skip unmatched closing parentheses
+	for parser.pos < len(parser.tokens) {
+		if child := parser.parseExpr(false, anyField); child != nil {
+			children = append(children, child)
+		}
+		if parser.peek() == opRParen {
+			parser.next()
+		}
+	}
+
+	if len(children) == 0 {
+		return nil, parser.terms
+	} else if len(children) == 1 {
+		return children[0], parser.terms
+	}
+	return &andNode{children}, parser.terms
+}
+
+// Returns true if the query uses any boolean or field operator, or parentheses
+func IsBooleanQuery(query string) bool {
+	for _, token := range tokenizeQuery(query) {
+		switch token {
+		case opAnd, opOr, opNot, opMinus, opLParen, opRParen:
+			return true
+		}
+		if _, _, ok := splitField(token); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the sorted page IDs matching a boolean query,
+// together with the words to rank them by.
+func booleanRetrieval(query string, viewer *database.Viewer) ([]uint64, []string) {
+	tree, terms := parseQuery(query)
+	if tree == nil {
+		return []uint64{}, terms
+	}
+	return tree.eval(&queryContext{viewer: viewer}), terms
+}
@@ -0,0 +1,102 @@
+package retrieval
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetOperations(t *testing.T) {
+	list1 := []uint64{1, 3, 5, 7}
+	list2 := []uint64{2, 3, 7, 8}
+
+	if !reflect.DeepEqual(union(list1, list2), []uint64{1, 2, 3, 5, 7, 8}) {
+		t.Log(union(list1, list2))
+		t.Fail()
+	}
+
+	if !reflect.DeepEqual(difference(list1, list2), []uint64{1, 5}) {
+		t.Log(difference(list1, list2))
+		t.Fail()
+	}
+
+	if !reflect.DeepEqual(intersect(list1, list2), []uint64{3, 7}) {
+		t.Log(intersect(list1, list2))
+		t.Fail()
+	}
+}
+
+func TestTokenizeQuery(t *testing.T) {
+	tokens := tokenizeQuery(`(cse OR engineering) -admission "final year project"`)
+	expected := []string{"(", "cse", "OR", "engineering", ")", "-", "admission", "\"final year project\""}
+
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Log(tokens)
+		t.Fail()
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	_, terms := parseQuery(`(cse OR engineering) -admission "final year project"`)
+	expected := preprocessText("cse engineering final year project")
+
+	if !reflect.DeepEqual(terms, expected) {
+		t.Log(terms)
+		t.Fail()
+	}
+
+	if tree, _ := parseQuery("AND ) -"); tree != nil {
+		t.Fail()
+	}
+}
+
+func TestIsBooleanQuery(t *testing.T) {
+	testcases := map[string]bool{
+		"hong kong":             false,
+		"\"hong kong\"":         false,
+		"e-mail":                false,
+		"hong OR kong":          true,
+		"hong -kong":            true,
+		"(hong kong)":           true,
+		"hong NOT kong":         true,
+		"hong and not kong":     false,
+		"\"hong\" AND \"kong\"": true,
+		"title:hong":            true,
+		"site:hku.hk":           true,
+		"http://hku.hk":         false,
+	}
+
+	for query, expected := range testcases {
+		if IsBooleanQuery(query) != expected {
+			t.Log(query)
+			t.Fail()
+		}
+	}
+}
+
+func TestSplitField(t *testing.T) {
+	testcases := map[string][]string{
+		"title:hkust":     {"title", "hkust"},
+		"body:":           {"body", ""},
+		"site:cse.ust.hk": {"site", "cse.ust.hk"},
+		"inurl:ug":        {"inurl", "ug"},
+	}
+
+	for token, expected := range testcases {
+		field, value, ok := splitField(token)
+		if !ok || field != expected[0] || value != expected[1] {
+			t.Log(token)
+			t.Fail()
+		}
+	}
+
+	if _, _, ok := splitField("http://cse.ust.hk"); ok {
+		t.Fail()
+	}
+}
+
+func TestSiteNode(t *testing.T) {
+	node := newSiteNode("ust.hk")
+	if !node.match("http://www.cse.ust.hk/ug") || !node.match("https://UST.hk/") || node.match("http://hkust.hk/") {
+		t.Fail()
+	}
+}
@@ -0,0 +1,95 @@
+package retrieval
+
+import (
+	"github.com/rsmohamad/comp4321/database"
+	"math"
+	"sort"
+)
+
+// Smallest value taken into the logarithm of a log-linear combination
+const logFloor = 1e-6
+
+// Scale the scores of the documents to [0, 1] by the maximum score
+func normaliseScores(scores map[uint64]float64, ids []uint64) map[uint64]float64 {
+	max := 0.0
+	for _, id := range ids {
+		max = math.Max(max, scores[id])
+	}
+
+	rv := make(map[uint64]float64)
+	for _, id := range ids {
+		if max > 0 {
+			rv[id] = scores[id] / max
+		}
+	}
+	return rv
+}
+
+// Combine the content score and the PageRank of each document.
+// Both are normalised over the documents first, then combined as
+//
+//	ContentWeight * content + PageRankWeight * pagerank
+//
+// or with LogLinear set,
+//
+//	ContentWeight * log(content) + PageRankWeight * log(pagerank)
+func blendPageRank(scores map[uint64]float64, ids []uint64, viewer *database.Viewer, opts Options) map[uint64]float64 {
+	pageRanks := make(map[uint64]float64)
+	for _, id := range ids {
+		pageRanks[id] = viewer.GetPageRank(id)
+	}
+
+	content := normaliseScores(scores, ids)
+	pageRanks = normaliseScores(pageRanks, ids)
+
+	rv := make(map[uint64]float64)
+	for _, id := range ids {
+		if opts.LogLinear {
+			rv[id] = opts.ContentWeight*math.Log(math.Max(content[id], logFloor)) +
+				opts.PageRankWeight*math.Log(math.Max(pageRanks[id], logFloor))
+		} else {
+			rv[id] = opts.ContentWeight*content[id] + opts.PageRankWeight*pageRanks[id]
+		}
+	}
+	return rv
+}
+
+// Sort the documents by their final score in descending order.
+// The content scores are blended with PageRank if the options give PageRank a weight.
+func rankDocuments(scores map[uint64]float64, ids []uint64, viewer *database.Viewer, opts Options) map[uint64]float64 {
+	if opts.PageRankWeight != 0 {
+		scores = blendPageRank(scores, ids, viewer, opts)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return scores[ids[i]] > scores[ids[j]]
+	})
+	return scores
+}
+
+// Keep the best ranked page of each cluster of near duplicates.
+// Returns the kept ids in rank order and the number of duplicates left out for each.
+func collapseDuplicates(ids []uint64, viewer *database.Viewer) ([]uint64, map[uint64]int) {
+	return collapseWith(ids, viewer.GetRepresentatives(ids))
+}
+
+// Same as collapseDuplicates, with the representatives of the pages, see Viewer.GetRepresentatives
+func collapseWith(ids []uint64, reps map[uint64]uint64) ([]uint64, map[uint64]int) {
+	kept := make([]uint64, 0, len(ids))
+	similar := make(map[uint64]int)
+	best := make(map[uint64]uint64)
+
+	for _, id := range ids {
+		rep, found := reps[id]
+		if !found {
+			rep = id
+		}
+		if first, seen := best[rep]; seen {
+			similar[first]++
+			continue
+		}
+		best[rep] = id
+		kept = append(kept, id)
+	}
+	return kept, similar
+}
@@ -3,29 +3,15 @@ package retrieval
 import (
 	"github.com/rsmohamad/comp4321/database"
 	"github.com/rsmohamad/comp4321/models"
-	"github.com/rsmohamad/comp4321/stopword"
-	"github.com/surgebase/porter2"
+	"github.com/rsmohamad/comp4321/tokenizer"
 	"log"
 	"math"
-	"regexp"
 	"sort"
-	"strings"
 )
 
-func preprocessText(query string) (rv []string) {
-	regex := regexp.MustCompile("[^a-zA-Z0-9 ]")
-	query = regex.ReplaceAllString(query, " ")
-	regex = regexp.MustCompile("[^\\s]+")
-	words := regex.FindAllString(query, -1)
-	for _, word := range words {
-		cleaned := strings.ToLower(word)
-		cleaned = strings.TrimSpace(cleaned)
-		cleaned = porter2.Stem(cleaned)
-		if !stopword.IsStopWord(cleaned) {
-			rv = append(rv, cleaned)
-		}
-	}
-	return
+// Query words are tokenized the same way as pages
+func preprocessText(query string) []string {
+	return tokenizer.Tokenize(query)
 }
 
 func extractPhrases(query string) []string {
@@ -47,27 +33,91 @@ func extractPhrases(query string) []string {
 	return phrases
 }
 
+// Number of results per page when none is requested
+const DefaultPageSize = 50
+
+// Largest number of results per page a request may ask for
+const MaxPageSize = 100
+
+// Model used to score documents against a query
+type RankingModel string
+
+const (
+	VSpace RankingModel = "vspace"
+	BM25   RankingModel = "bm25"
+	BM25F  RankingModel = "bm25f"
+)
+
+// Default weights of the final score
+const (
+	DefaultTitleBoost = 1.5
+
+	// Weight of PageRank when ranking with PageRank but no weight is given
+	DefaultPageRankWeight = 0.3
+)
+
+// Per request search options
+type Options struct {
+	// Page of results to return, counted from 1
+	Page int
+	Size int
+
+	Model RankingModel
+
+	// Weight of title matches relative to body matches
+	TitleBoost float64
+
+	// Weights of the content score and PageRank in the final score, see rank.go
+	ContentWeight  float64
+	PageRankWeight float64
+	LogLinear      bool
+
+	// Show near duplicates instead of only the best ranked page of each cluster
+	KeepDuplicates bool
+}
+
+// Returns the options for the first page of results ranked by the vector space model
+func DefaultOptions() Options {
+	return Options{
+		Page:          1,
+		Size:          DefaultPageSize,
+		Model:         VSpace,
+		TitleBoost:    DefaultTitleBoost,
+		ContentWeight: 1,
+	}
+}
+
 type SEngine struct {
 	viewer *database.Viewer
 }
 
 func NewSearchEngine(filename string) *SEngine {
-	se := SEngine{}
-	var err error
-	se.viewer, err = database.LoadViewer(filename)
+	se, err := LoadSearchEngine(filename)
 	if err != nil {
 		log.Fatal("Index file not found:", filename)
 	}
 
-	return &se
+	return se
+}
+
+// Returns a search engine over the index file, opened read-only.
+// Returns an error if the file is not an index.
+func LoadSearchEngine(filename string) (*SEngine, error) {
+	viewer, err := database.LoadViewer(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &SEngine{viewer}, nil
 }
 
-func (e *SEngine) getDocumentViewModels(docIds []uint64, scores map[uint64]float64) []*models.DocumentView {
+// Returns the views of the documents, with snippets for the query words
+func (e *SEngine) getDocumentViewModels(docIds []uint64, scores map[uint64]float64, query []string) []*models.DocumentView {
 	rv := make([]*models.DocumentView, len(docIds))
 	for i, id := range docIds {
 		doc := e.viewer.GetDocument(id)
 		if doc != nil {
 			docView := models.NewDocumentView(doc)
+			docView.Id = id
 			if scores == nil {
 				docView.Score = 1
 			} else {
@@ -76,60 +126,172 @@ func (e *SEngine) getDocumentViewModels(docIds []uint64, scores map[uint64]float
 			parents := e.viewer.GetParentLinks(id)
 			upper := int(math.Min(float64(len(parents)), 5.0))
 			docView.Parents = parents[0:upper]
+			docView.Snippet = makeSnippet(e.viewer.GetText(id), query)
 			rv[i] = docView
 		}
 	}
 	return rv
 }
 
-func (e *SEngine) RetrieveBoolean(query string) []*models.DocumentView {
-	preprocessed := preprocessText(query)
-	docIds := booleanFilter(preprocessed, e.viewer)
-	return e.getDocumentViewModels(docIds, nil)
+// Returns the view of a single document.
+// Returns nil if the pageId does not exist.
+func (e *SEngine) RetrieveDocument(pageId uint64) *models.DocumentView {
+	return e.getDocumentViewModels([]uint64{pageId}, nil, nil)[0]
+}
+
+// Returns the requested page of ranked results and the number of results.
+// Near duplicates are collapsed unless the options keep them.
+func (e *SEngine) resultPage(ids []uint64, scores map[uint64]float64, query []string, opts Options) ([]*models.DocumentView, int) {
+	similar := make(map[uint64]int)
+	if !opts.KeepDuplicates {
+		ids, similar = collapseDuplicates(ids, e.viewer)
+	}
+	return e.viewPage(ids, similar, scores, query, opts), len(ids)
+}
+
+// Returns the views of the ids on the requested page
+func (e *SEngine) viewPage(ids []uint64, similar map[uint64]int, scores map[uint64]float64, query []string, opts Options) []*models.DocumentView {
+	rv := e.getDocumentViewModels(paginate(ids, opts.Page, opts.Size), scores, query)
+	for _, docView := range rv {
+		if docView != nil {
+			docView.Similar = similar[docView.Id]
+		}
+	}
+	return rv
 }
 
-func (e *SEngine) RetrievePhrase(query string) []*models.DocumentView {
+// Returns the requested page of results when only the best pages are scored, see wand.go.
+// The number of best pages is doubled until the page is filled after collapsing near duplicates.
+// The number of results and of near duplicates counts all matching pages.
+func (e *SEngine) topKPage(query []string, opts Options) ([]*models.DocumentView, int) {
+	var scores map[uint64]float64
+	kept, similar, total := []uint64{}, make(map[uint64]int), 0
+
+	e.viewer.ScanQuery(query, func(index *database.QueryIndex, stats func(pageId uint64) database.PageStats) {
+		matching := matchingPages(index)
+		total = len(matching)
+
+		// Pages of each cluster of near duplicates among the matching pages
+		var reps map[uint64]uint64
+		clusters := make(map[uint64]int)
+		if !opts.KeepDuplicates {
+			reps = e.viewer.GetRepresentatives(matching)
+			for _, id := range matching {
+				rep, found := reps[id]
+				if !found {
+					rep = id
+				}
+				clusters[rep]++
+			}
+			total = len(clusters)
+		}
+
+		// Pages past the last result are empty, and their offsets could overflow
+		if opts.Page-1 > total/opts.Size {
+			return
+		}
+
+		needed := opts.Page * opts.Size
+		for k := needed; ; k *= 2 {
+			scorer, cursors := newWand(query, index, stats, opts)
+			var ids []uint64
+			scores, ids = wand(cursors, scorer, k)
+			kept = ids
+			if !opts.KeepDuplicates {
+				kept, _ = collapseWith(ids, reps)
+			}
+			if len(kept) >= needed || len(ids) < k {
+				break
+			}
+		}
+
+		for _, id := range kept {
+			rep, found := reps[id]
+			if !found {
+				rep = id
+			}
+			if clusters[rep] > 1 {
+				similar[id] = clusters[rep] - 1
+			}
+		}
+	})
+	return e.viewPage(kept, similar, scores, query, opts), total
+}
+
+// Returns true if the options rank by content alone, so that only the requested pages need scores
+func canPrune(opts Options) bool {
+	return opts.PageRankWeight == 0 && opts.Page > 0 && opts.Size > 0
+}
+
+// Returns the ids on the given page of results.
+// Pages are counted from 1.
+func paginate(ids []uint64, page, size int) []uint64 {
+	// Checked before multiplying, so that large pages cannot overflow
+	if page < 1 || size < 1 || page-1 > len(ids)/size {
+		return []uint64{}
+	}
+
+	start := (page - 1) * size
+	if start >= len(ids) {
+		return []uint64{}
+	}
+
+	upper := int(math.Min(float64(start+size), float64(len(ids))))
+	return ids[start:upper]
+}
+
+// Each Retrieve function returns the requested page of results
+// together with the total number of matching documents.
+
+// Retrieve documents matching a boolean query, see query.go.
+// Matches are ranked over the words that are not negated.
+func (e *SEngine) RetrieveBoolean(query string, opts Options) ([]*models.DocumentView, int) {
+	docIds, terms := booleanRetrieval(query, e.viewer)
+	if len(terms) == 0 {
+		return e.resultPage(docIds, nil, terms, opts)
+	}
+
+	scores, docIds := scoreDocuments(terms, e.viewer, docIds, opts)
+	scores = rankDocuments(scores, docIds, e.viewer, opts)
+
+	return e.resultPage(docIds, scores, terms, opts)
+}
+
+func (e *SEngine) RetrievePhrase(query string, opts Options) ([]*models.DocumentView, int) {
 	phrases := extractPhrases(query)
 	if len(phrases) == 0 {
-		return e.RetrieveVSpace(query)
+		return e.RetrieveVSpace(query, opts)
 	}
 
-	scores, ids := retrievePhrase(phrases, query, e.viewer)
-	sort.Slice(ids, func(i, j int) bool {
-		return scores[ids[i]] > scores[ids[j]]
-	})
+	scores, ids := retrievePhrase(phrases, query, e.viewer, opts)
+	scores = rankDocuments(scores, ids, e.viewer, opts)
 
-	upper := int(math.Min(50.0, float64(len(ids))))
-	return e.getDocumentViewModels(ids[0:upper], scores)
+	return e.resultPage(ids, scores, preprocessText(query), opts)
 }
 
-func (e *SEngine) RetrieveVSpace(query string) []*models.DocumentView {
+// Retrieve documents containing any of the query words.
+// Unless PageRank is blended in, only the best documents up to the requested page are scored.
+func (e *SEngine) RetrieveVSpace(query string, opts Options) ([]*models.DocumentView, int) {
 	preprocessed := preprocessText(query)
-	scores, docIds := vspaceRetrieval(preprocessed, e.viewer)
+	if canPrune(opts) {
+		return e.topKPage(preprocessed, opts)
+	}
 
-	sort.Slice(docIds, func(i, j int) bool {
-		return scores[docIds[i]] > scores[docIds[j]]
-	})
+	scores, docIds := vspaceRetrieval(preprocessed, e.viewer, opts)
+	scores = rankDocuments(scores, docIds, e.viewer, opts)
 
-	upper := int(math.Min(50.0, float64(len(docIds))))
-	return e.getDocumentViewModels(docIds[0:upper], scores)
+	return e.resultPage(docIds, scores, preprocessed, opts)
 }
 
 // Search for needle within the results of haystack
-func (e *SEngine) RetrieveNested(haystack, needle string) []*models.DocumentView {
+func (e *SEngine) RetrieveNested(haystack, needle string, opts Options) ([]*models.DocumentView, int) {
 	searchKeyword := func(query string) (map[uint64]float64, []uint64) {
 		phrases := extractPhrases(query)
 		if len(phrases) == 0 {
 			preprocessed := preprocessText(query)
-			return vspaceRetrieval(preprocessed, e.viewer)
+			return vspaceRetrieval(preprocessed, e.viewer, opts)
 		}
-		return retrievePhrase(phrases, query, e.viewer)
-	}
-
-	sortByScore := func(ids []uint64, scores map[uint64]float64) {
-		sort.Slice(ids, func(i, j int) bool {
-			return scores[ids[i]] > scores[ids[j]]
-		})
+		return retrievePhrase(phrases, query, e.viewer, opts)
 	}
 
 	sortByIds := func(ids []uint64) {
@@ -141,38 +303,26 @@ func (e *SEngine) RetrieveNested(haystack, needle string) []*models.DocumentView
 	scores, haystackIds := searchKeyword(haystack)
 	_, needleIds := searchKeyword(needle)
 
-	sortByScore(haystackIds, scores)
-	upper := int(math.Min(50.0, float64(len(haystackIds))))
-	haystackIds = haystackIds[0:upper]
-
 	sortByIds(haystackIds)
 	sortByIds(needleIds)
 	combined := intersect(haystackIds, needleIds)
-	sortByScore(combined, scores)
-	return e.getDocumentViewModels(combined, scores)
+	scores = rankDocuments(scores, combined, e.viewer, opts)
+	query := append(preprocessText(haystack), preprocessText(needle)...)
+	return e.resultPage(combined, scores, query, opts)
 }
 
-func (e *SEngine) RetrievePageRank(query string) []*models.DocumentView {
-	preprocessed := preprocessText(query)
-	scores, docIds := vspaceRetrieval(preprocessed, e.viewer)
-
-	sort.Slice(docIds, func(i, j int) bool {
-		return scores[docIds[i]] > scores[docIds[j]]
-	})
-
-	upper := int(math.Min(50.0, float64(len(docIds))))
-	docIds = docIds[0:upper]
-
-	pageRanks := make(map[uint64]float64)
-	for _, docId := range docIds {
-		pageRanks[docId] = e.viewer.GetPageRank(docId)
+// Ranks the documents by content score blended with PageRank.
+// Uses DefaultPageRankWeight if the options do not give PageRank a weight.
+func (e *SEngine) RetrievePageRank(query string, opts Options) ([]*models.DocumentView, int) {
+	if opts.PageRankWeight == 0 {
+		opts.PageRankWeight = DefaultPageRankWeight
 	}
+	return e.RetrievePhrase(query, opts)
+}
 
-	sort.Slice(docIds, func(i, j int) bool {
-		return pageRanks[docIds[i]] > pageRanks[docIds[j]]
-	})
-
-	return e.getDocumentViewModels(docIds, pageRanks)
+// Returns all words in the index
+func (e *SEngine) GetKeywords() []string {
+	return e.viewer.GetKeywords()
 }
 
 func (e *SEngine) Close() {
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/rsmohamad/comp4321/database"
 	"github.com/rsmohamad/comp4321/models"
+	"math"
+	"math/rand"
 	"testing"
 )
 
@@ -74,7 +76,7 @@ func TestSEngine_RetrieveBoolean(t *testing.T) {
 	defer se.Close()
 
 	for i := 0; i < 10; i++ {
-		res := se.RetrieveBoolean(fmt.Sprint(i))
+		res, _ := se.RetrieveBoolean(fmt.Sprint(i), DefaultOptions())
 
 		if len(res) != 1 {
 			t.Fail()
@@ -86,13 +88,43 @@ func TestSEngine_RetrieveBoolean(t *testing.T) {
 	}
 }
 
+func TestSEngine_RetrieveBooleanOperators(t *testing.T) {
+	insertIntoIndex(10)
+	se := NewSearchEngine("index_test.db")
+	defer se.Close()
+
+	testcases := map[string]int{
+		"1 OR 2":                 2,
+		"1 AND 2":                0,
+		"(1 OR 2 OR 3) -2":       2,
+		"NOT 1":                  9,
+		"-1 -2":                  8,
+		"\"3\" OR (4)":           2,
+		"title:0":                1,
+		"body:0":                 0,
+		"body:\"3\"":             1,
+		"site:3.com":             1,
+		"inurl:com":              10,
+		"inurl:1 OR inurl:2":     2,
+		"title:(1 OR 2) -body:1": 1,
+	}
+
+	for query, expected := range testcases {
+		res, total := se.RetrieveBoolean(query, DefaultOptions())
+		if len(res) != expected || total != expected {
+			t.Log(query, len(res))
+			t.Fail()
+		}
+	}
+}
+
 func TestSEngine_RetrievePhrase(t *testing.T) {
 	insertIntoIndex(10)
 	se := NewSearchEngine("index_test.db")
 	defer se.Close()
 
 	for i := 0; i < 10; i++ {
-		res := se.RetrievePhrase(fmt.Sprintf("\"%d\"", i))
+		res, _ := se.RetrievePhrase(fmt.Sprintf("\"%d\"", i), DefaultOptions())
 
 		if len(res) != 1 {
 			t.Fail()
@@ -110,7 +142,7 @@ func TestSEngine_RetrieveVSpace(t *testing.T) {
 	defer se.Close()
 
 	for i := 0; i < 10; i++ {
-		res := se.RetrieveVSpace(fmt.Sprint(i))
+		res, _ := se.RetrieveVSpace(fmt.Sprint(i), DefaultOptions())
 
 		if len(res) != 1 {
 			t.Fail()
@@ -121,3 +153,200 @@ func TestSEngine_RetrieveVSpace(t *testing.T) {
 		}
 	}
 }
+
+func TestSEngine_RetrieveDocument(t *testing.T) {
+	insertIntoIndex(10)
+	se := NewSearchEngine("index_test.db")
+	defer se.Close()
+
+	for i := 0; i < 10; i++ {
+		doc := se.RetrieveDocument(uint64(i + 1))
+		if doc == nil || doc.Id != uint64(i+1) || doc.Title != fmt.Sprint(i) {
+			t.Fail()
+		}
+	}
+
+	if se.RetrieveDocument(11) != nil {
+		t.Fail()
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	ids := []uint64{1, 2, 3, 4, 5}
+
+	testcases := []struct {
+		page, size int
+		expected   int
+	}{
+		{1, 2, 2}, {3, 2, 1}, {4, 2, 0}, {0, 2, 0}, {1, 0, 0}, {1, 10, 5}, {1 << 62, 4, 0},
+	}
+
+	for _, tc := range testcases {
+		if len(paginate(ids, tc.page, tc.size)) != tc.expected {
+			t.Log(tc)
+			t.Fail()
+		}
+	}
+
+	if paginate(ids, 2, 2)[0] != 3 {
+		t.Fail()
+	}
+}
+
+func TestSEngine_RetrieveBM25(t *testing.T) {
+	insertIntoIndex(10)
+	se := NewSearchEngine("index_test.db")
+	defer se.Close()
+
+	for _, model := range []RankingModel{BM25, BM25F} {
+		opts := DefaultOptions()
+		opts.Model = model
+
+		for i := 1; i < 10; i++ {
+			res, _ := se.RetrieveVSpace(fmt.Sprint(i), opts)
+
+			if len(res) != 1 || res[0].Title != fmt.Sprint(i) || res[0].Score <= 0 {
+				t.Log(model, i)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestBlendPageRank(t *testing.T) {
+	insertIntoIndex(10)
+	indexer, _ := database.LoadIndexer("index_test.db")
+	indexer.UpdateAdjList()
+	indexer.UpdatePageRank()
+	indexer.Close()
+
+	se := NewSearchEngine("index_test.db")
+	defer se.Close()
+
+	ids := []uint64{2, 3}
+	scores := map[uint64]float64{2: 1, 3: 0.5}
+
+	opts := DefaultOptions()
+	opts.ContentWeight = 0.5
+	opts.PageRankWeight = 0.5
+	blended := blendPageRank(scores, ids, se.viewer, opts)
+	if blended[2] != 1 || blended[3] != 0.75 {
+		t.Log(blended)
+		t.Fail()
+	}
+
+	opts.LogLinear = true
+	blended = blendPageRank(scores, ids, se.viewer, opts)
+	if blended[2] != 0 || blended[3] >= 0 {
+		t.Log(blended)
+		t.Fail()
+	}
+
+	ranked := rankDocuments(map[uint64]float64{2: 0.5, 3: 1}, ids, se.viewer, DefaultOptions())
+	if ids[0] != 3 || ranked[3] != 1 {
+		t.Fail()
+	}
+}
+
+func TestSEngine_CollapseDuplicates(t *testing.T) {
+	indexer, _ := database.LoadIndexer("index_test.db")
+	indexer.DropAll()
+	for i, fingerprint := range []uint64{0xFF00FF00FF00FF00, 0xFF00FF00FF00FF01, 0x00FF00FF00FF00FF} {
+		indexer.UpdateOrAddPage(&models.Document{
+			Uri:         fmt.Sprintf("http://%d.com/", i),
+			Title:       "mirror",
+			Words:       models.CountTfandIdx([]string{"mirror"}),
+			Titles:      models.CountTfandIdx([]string{"mirror"}),
+			MaxTf:       1,
+			TitleMaxTf:  1,
+			Fingerprint: fingerprint,
+		})
+	}
+	indexer.FlushInverted()
+	indexer.UpdateTermWeights()
+	indexer.Close()
+
+	se := NewSearchEngine("index_test.db")
+	defer se.Close()
+
+	opts := DefaultOptions()
+	results, total := se.RetrieveVSpace("mirror", opts)
+	if total != 2 || len(results) != 2 {
+		t.Fatal("Expected 2 results, got", total)
+	}
+	similar := results[0].Similar + results[1].Similar
+	if similar != 1 {
+		t.Error("Expected 1 collapsed duplicate, got", similar)
+	}
+
+	opts.KeepDuplicates = true
+	if _, total = se.RetrieveVSpace("mirror", opts); total != 3 {
+		t.Error("Expected 3 results with duplicates, got", total)
+	}
+}
+
+func TestTopKRetrieval(t *testing.T) {
+	indexer, _ := database.LoadIndexer("index_test.db")
+	indexer.DropAll()
+	random := rand.New(rand.NewSource(1))
+	vocabulary := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for i := 0; i < 60; i++ {
+		words := make([]string, 1+random.Intn(40))
+		for j := range words {
+			words[j] = vocabulary[random.Intn(len(vocabulary))]
+		}
+		titles := []string{vocabulary[random.Intn(len(vocabulary))], vocabulary[random.Intn(len(vocabulary))]}
+		doc := &models.Document{
+			Uri:    fmt.Sprintf("http://%d.com/", i),
+			Title:  fmt.Sprint(i),
+			Words:  models.CountTfandIdx(words),
+			Titles: models.CountTfandIdx(titles),
+		}
+		doc.MaxTf = models.CountMaxTf(doc.Words)
+		doc.TitleMaxTf = models.CountMaxTf(doc.Titles)
+		indexer.UpdateOrAddPage(doc)
+	}
+	indexer.FlushInverted()
+	indexer.UpdateTermWeights()
+	indexer.Close()
+
+	se := NewSearchEngine("index_test.db")
+	defer se.Close()
+
+	for _, model := range []RankingModel{VSpace, BM25, BM25F} {
+		for _, query := range [][]string{{"a"}, {"b", "h"}, {"c", "c", "e", "unknown"}} {
+			opts := DefaultOptions()
+			opts.Model = model
+			scores, ids := vspaceRetrieval(query, se.viewer, opts)
+			scores = rankDocuments(scores, ids, se.viewer, opts)
+
+			topScores, topIds, matches := topKRetrieval(query, se.viewer, 5, opts)
+			if matches != len(ids) || len(topIds) != 5 {
+				t.Fatal(model, query, "matches", matches, len(ids), "top", len(topIds))
+			}
+			for i, id := range topIds {
+				if math.Abs(topScores[id]-scores[ids[i]]) > 1e-9 {
+					t.Error(model, query, i, "score", topScores[id], "expected", scores[ids[i]])
+				}
+			}
+		}
+	}
+
+	// Totals count all matching pages, as without pruning
+	opts := DefaultOptions()
+	opts.Size = 5
+	for _, query := range [][]string{{"a"}, {"b", "h"}} {
+		scores, ids := vspaceRetrieval(query, se.viewer, opts)
+		scores = rankDocuments(scores, ids, se.viewer, opts)
+		expected, expectedTotal := se.resultPage(ids, scores, query, opts)
+		results, total := se.topKPage(query, opts)
+		if total != expectedTotal || len(results) != len(expected) || results[0].Id != expected[0].Id {
+			t.Error(query, "total", total, "expected", expectedTotal)
+		}
+	}
+
+	opts.Page = 1 << 62
+	if results, total := se.RetrieveVSpace("a", opts); len(results) != 0 || total == 0 {
+		t.Error("Expected no results past the last page, got", len(results), total)
+	}
+}
@@ -0,0 +1,131 @@
+package retrieval
+
+import (
+	"github.com/rsmohamad/comp4321/models"
+	"github.com/rsmohamad/comp4321/tokenizer"
+	"unicode"
+)
+
+// Number of words in a snippet
+const snippetLength = 30
+
+// Returns the whitespace separated words of the text as strings.Fields does,
+// with the byte offset of each one
+func fieldOffsets(text string) (words []string, offsets []int) {
+	start := -1
+	for i, r := range text {
+		if !unicode.IsSpace(r) {
+			if start < 0 {
+				start = i
+			}
+		} else if start >= 0 {
+			words, offsets = append(words, text[start:i]), append(offsets, start)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words, offsets = append(words, text[start:]), append(offsets, start)
+	}
+	return
+}
+
+// Returns which words contain a token that is one of the terms.
+// The text is tokenized once and each token is matched to the word it falls in.
+func matchTerms(text string, offsets []int, terms map[string]bool) []bool {
+	matched := make([]bool, len(offsets))
+	tokens, tokenOffsets := tokenizer.TokenizeOffsets(text)
+	word := 0
+	for i, token := range tokens {
+		for word+1 < len(offsets) && offsets[word+1] <= tokenOffsets[i] {
+			word++
+		}
+		if terms[token] {
+			matched[word] = true
+		}
+	}
+	return matched
+}
+
+// Returns a query-biased snippet of the text.
+// Picks the window of words with the most query matches and marks the matched words.
+func makeSnippet(text string, query []string) []models.SnippetFragment {
+	words, offsets := fieldOffsets(text)
+	rv := make([]models.SnippetFragment, 0)
+	if len(words) == 0 {
+		return rv
+	}
+
+	terms := make(map[string]bool)
+	for _, term := range query {
+		terms[term] = true
+	}
+
+	matched := matchTerms(text, offsets, terms)
+
+	// Slide a window over the words and keep the one with the most matches
+	start, best, count := 0, 0, 0
+	for i := range words {
+		if matched[i] {
+			count++
+		}
+		if i >= snippetLength && matched[i-snippetLength] {
+			count--
+		}
+		if count > best {
+			best = count
+			start = i - snippetLength + 1
+			if start < 0 {
+				start = 0
+			}
+		}
+	}
+
+	// Centre the window on its matches
+	if best > 0 {
+		first, last := -1, -1
+		for i := start; i < start+snippetLength && i < len(words); i++ {
+			if matched[i] {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		start = (first+last)/2 - snippetLength/2
+		if start > len(words)-snippetLength {
+			start = len(words) - snippetLength
+		}
+		if start < 0 {
+			start = 0
+		}
+	}
+
+	end := start + snippetLength
+	if end > len(words) {
+		end = len(words)
+	}
+
+	// Merge consecutive unmatched words into one fragment
+	appendText := func(text string, match bool) {
+		last := len(rv) - 1
+		if !match && last >= 0 && !rv[last].Match {
+			rv[last].Text += text
+		} else {
+			rv = append(rv, models.SnippetFragment{Text: text, Match: match})
+		}
+	}
+
+	if start > 0 {
+		appendText("... ", false)
+	}
+	for i := start; i < end; i++ {
+		if i > start {
+			appendText(" ", false)
+		}
+		appendText(words[i], matched[i])
+	}
+	if end < len(words) {
+		appendText(" ...", false)
+	}
+	return rv
+}
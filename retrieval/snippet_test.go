@@ -0,0 +1,41 @@
+package retrieval
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMakeSnippet(t *testing.T) {
+	words := make([]string, 100)
+	for i := range words {
+		words[i] = "filler"
+	}
+	words[70] = "Computers"
+	text := strings.Join(words, " ")
+
+	snippet := makeSnippet(text, []string{"comput"})
+	if len(snippet) != 3 {
+		t.Fatal("Expected 3 fragments, got", len(snippet))
+	}
+	if !strings.HasPrefix(snippet[0].Text, "... ") || !snippet[1].Match || snippet[1].Text != "Computers" {
+		t.Error("Wrong snippet", snippet)
+	}
+	if snippet[2].Match || !strings.HasSuffix(snippet[2].Text, " ...") {
+		t.Error("Expected snippet to be truncated after the match", snippet)
+	}
+
+	snippet = makeSnippet("short text", []string{"comput"})
+	if len(snippet) != 1 || snippet[0].Text != "short text" || snippet[0].Match {
+		t.Error("Wrong snippet without matches", snippet)
+	}
+
+	// Words are matched by the tokens inside them
+	snippet = makeSnippet("the  (Computers),\tand computing-rooms", []string{"comput", "room"})
+	if len(snippet) != 4 || snippet[1].Text != "(Computers)," || snippet[3].Text != "computing-rooms" || !snippet[3].Match {
+		t.Error("Wrong snippet with punctuation", snippet)
+	}
+
+	if len(makeSnippet("", []string{"comput"})) != 0 {
+		t.Error("Expected empty snippet for empty text")
+	}
+}
@@ -5,59 +5,69 @@ import (
 	"math"
 )
 
-type CosSimResult struct {
-	score float64
-	docId uint64
+// Returns the distinct documents in the order they were given, each with a score of 0
+func candidateDocuments(docsToSearch []uint64) (map[uint64]float64, []uint64) {
+	documentScores := make(map[uint64]float64)
+	documentIds := make([]uint64, 0)
+	for _, id := range docsToSearch {
+		if _, exist := documentScores[id]; !exist {
+			documentScores[id] = 0
+			documentIds = append(documentIds, id)
+		}
+	}
+	return documentScores, documentIds
 }
 
-func cosSim(query []string, docId uint64, viewer *database.Viewer, res *chan *CosSimResult) *CosSimResult {
-	var textInnerProduct float64 = 0
-	var titleInnerProduct float64 = 0
-	queryMag := math.Sqrt(float64(len(query)))
-	docMag := viewer.GetMagnitude(docId, false)
-	titleMag := viewer.GetMagnitude(docId, true)
-
+// Sum the weights of the query words in each candidate document, term at a time
+func innerProducts(query []string, postings map[string][]database.Posting, candidates map[uint64]float64) map[uint64]float64 {
+	rv := make(map[uint64]float64)
 	for _, word := range query {
-		textInnerProduct += viewer.GetTfIdf(docId, word, false)
-		titleInnerProduct += viewer.GetTfIdf(docId, word, true)
-	}
-
-	textScore := textInnerProduct / (queryMag * docMag)
-	titleScore := titleInnerProduct / (queryMag * titleMag)
-	score := textScore
-	if !math.IsNaN(titleScore) {
-		score += titleScore * 1.5
+		for _, p := range postings[word] {
+			if _, found := candidates[p.PageId]; found {
+				rv[p.PageId] += p.Weight
+			}
+		}
 	}
-
-	rv := &CosSimResult{score, docId}
-	*res <- rv
 	return rv
 }
 
-func getDocumentScores(query []string, viewer *database.Viewer, docsToSearch []uint64) (map[uint64]float64, []uint64) {
-	documentScores := make(map[uint64]float64)
-	documentIds := make([]uint64, 0)
-	res := make(chan *CosSimResult)
-	defer close(res)
+// Returns the cosine similarity of the documents to the query.
+// The similarity of the titles is added with the titleBoost weight.
+func getDocumentScores(query []string, viewer *database.Viewer, docsToSearch []uint64, titleBoost float64) (map[uint64]float64, []uint64) {
+	documentScores, documentIds := candidateDocuments(docsToSearch)
+	index := viewer.GetQueryIndex(query, documentIds)
 
-	for _, id := range docsToSearch {
-		_, exist := documentScores[id]
-		if !exist {
-			go cosSim(query, id, viewer, &res)
-			documentScores[id] = 0
-			documentIds = append(documentIds, id)
-		}
-	}
+	queryMag := math.Sqrt(float64(len(query)))
+	textProducts := innerProducts(query, index.Body, documentScores)
+	titleProducts := innerProducts(query, index.Title, documentScores)
 
-	for range documentIds {
-		result := <-res
-		documentScores[result.docId] = result.score
+	for _, id := range documentIds {
+		stats := index.Pages[id]
+		if stats.Magnitude > 0 {
+			documentScores[id] += textProducts[id] / (queryMag * stats.Magnitude)
+		}
+		if stats.TitleMagnitude > 0 {
+			documentScores[id] += titleProducts[id] / (queryMag * stats.TitleMagnitude) * titleBoost
+		}
 	}
 
 	return documentScores, documentIds
 }
 
-func vspaceRetrieval(query []string, viewer *database.Viewer) (map[uint64]float64, []uint64) {
+// Scores the documents with the ranking model of the options
+func scoreDocuments(query []string, viewer *database.Viewer, docsToSearch []uint64, opts Options) (map[uint64]float64, []uint64) {
+	switch opts.Model {
+	case BM25:
+		return getBM25Scores(query, viewer, docsToSearch, 0)
+	case BM25F:
+		return getBM25Scores(query, viewer, docsToSearch, opts.TitleBoost)
+	default:
+		return getDocumentScores(query, viewer, docsToSearch, opts.TitleBoost)
+	}
+}
+
+// Scores all documents containing any of the query words
+func vspaceRetrieval(query []string, viewer *database.Viewer, opts Options) (map[uint64]float64, []uint64) {
 	docsToSearch := make([]uint64, 0)
 	res := make(chan []uint64)
 
@@ -72,5 +82,5 @@ func vspaceRetrieval(query []string, viewer *database.Viewer) (map[uint64]float6
 		docsToSearch = append(docsToSearch, <-res...)
 	}
 
-	return getDocumentScores(query, viewer, docsToSearch)
+	return scoreDocuments(query, viewer, docsToSearch, opts)
 }
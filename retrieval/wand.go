@@ -0,0 +1,312 @@
+package retrieval
+
+import (
+	"container/heap"
+	"github.com/rsmohamad/comp4321/database"
+	"math"
+	"sort"
+)
+
+// Top-k retrieval with WAND pruning.
+// Pages are scored document at a time over the posting lists of the query words.
+// A page is only scored if the upper bounds of the lists containing it could beat
+// the k-th best score so far. Bounds come from Indexer.UpdateTermWeights.
+
+// Cursor over the postings of a query word in one field
+type postingCursor struct {
+	word     string
+	title    bool
+	postings []database.Posting
+	pos      int
+
+	// Upper bound of the score the list adds to a page
+	bound float64
+}
+
+func (c *postingCursor) done() bool {
+	return c.pos >= len(c.postings)
+}
+
+func (c *postingCursor) current() database.Posting {
+	return c.postings[c.pos]
+}
+
+// Move to the first posting at or after pageId
+func (c *postingCursor) seek(pageId uint64) {
+	rest := c.postings[c.pos:]
+	c.pos += sort.Search(len(rest), func(i int) bool {
+		return rest[i].PageId >= pageId
+	})
+}
+
+// Scoring model used by WAND
+type pageScorer interface {
+	// Upper bound of the score a list adds to a page
+	bound(word string, title bool) float64
+
+	// Score of a page from the cursors positioned on it
+	score(pageId uint64, matches []*postingCursor) float64
+}
+
+// Cosine similarity, as in getDocumentScores
+type vspaceScorer struct {
+	index      *database.QueryIndex
+	stats      func(pageId uint64) database.PageStats
+	counts     map[string]int
+	queryMag   float64
+	titleBoost float64
+}
+
+func (s *vspaceScorer) bound(word string, title bool) float64 {
+	bounds, weight := s.index.BodyBounds, 1.0
+	if title {
+		bounds, weight = s.index.TitleBounds, s.titleBoost
+	}
+	b, found := bounds[word]
+	if !found {
+		return math.Inf(1)
+	}
+	return float64(s.counts[word]) * b.Cosine * weight / s.queryMag
+}
+
+func (s *vspaceScorer) score(pageId uint64, matches []*postingCursor) float64 {
+	stats := s.stats(pageId)
+	rv := 0.0
+	for _, c := range matches {
+		product := float64(s.counts[c.word]) * c.current().Weight
+		if !c.title && stats.Magnitude > 0 {
+			rv += product / (s.queryMag * stats.Magnitude)
+		} else if c.title && stats.TitleMagnitude > 0 {
+			rv += product / (s.queryMag * stats.TitleMagnitude) * s.titleBoost
+		}
+	}
+	return rv
+}
+
+// BM25, or BM25F if titleWeight is not zero, as in getBM25Scores
+type bm25Scorer struct {
+	index       *database.QueryIndex
+	stats       func(pageId uint64) database.PageStats
+	counts      map[string]int
+	idf         map[string]float64
+	titleWeight float64
+}
+
+func saturate(tf float64) float64 {
+	return tf * (bm25K1 + 1) / (tf + bm25K1)
+}
+
+// BM25F adds the title and body frequencies before saturating them.
+// Saturation is concave, so the sum of the bounds of the fields still bounds the score.
+func (s *bm25Scorer) bound(word string, title bool) float64 {
+	bounds, weight, avgLength := s.index.BodyBounds, 1.0, s.index.AvgLength
+	if title {
+		bounds, weight, avgLength = s.index.TitleBounds, s.titleWeight, s.index.AvgTitleLength
+	}
+	if weight == 0 {
+		return 0
+	}
+	b, found := bounds[word]
+	if !found {
+		return math.Inf(1)
+	}
+	return float64(s.counts[word]) * s.idf[word] * saturate(weight*normalisedTf(b.MaxTf, b.MinLength, avgLength))
+}
+
+func (s *bm25Scorer) score(pageId uint64, matches []*postingCursor) float64 {
+	stats := s.stats(pageId)
+	tfs := make(map[string]float64)
+	for _, c := range matches {
+		if !c.title {
+			tfs[c.word] += normalisedTf(c.current().Tf, stats.Length, s.index.AvgLength)
+		} else if s.titleWeight != 0 {
+			tfs[c.word] += s.titleWeight * normalisedTf(c.current().Tf, stats.TitleLength, s.index.AvgTitleLength)
+		}
+	}
+
+	rv := 0.0
+	for word, tf := range tfs {
+		if tf > 0 {
+			rv += float64(s.counts[word]) * s.idf[word] * saturate(tf)
+		}
+	}
+	return rv
+}
+
+// Scored page in the heap of the best pages
+type scoredPage struct {
+	id    uint64
+	score float64
+}
+
+// Returns true if a ranks below b. Ties are ranked by ascending page ID.
+func ranksBelow(a, b scoredPage) bool {
+	if a.score != b.score {
+		return a.score < b.score
+	}
+	return a.id > b.id
+}
+
+// Min-heap of the best pages, worst on top
+type pageHeap []scoredPage
+
+func (h pageHeap) Len() int            { return len(h) }
+func (h pageHeap) Less(i, j int) bool  { return ranksBelow(h[i], h[j]) }
+func (h pageHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *pageHeap) Push(x interface{}) { *h = append(*h, x.(scoredPage)) }
+func (h *pageHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Returns the k best pages of the lists and their scores, best first.
+func wand(cursors []*postingCursor, scorer pageScorer, k int) (map[uint64]float64, []uint64) {
+	best := &pageHeap{}
+	if k < 1 {
+		return make(map[uint64]float64), []uint64{}
+	}
+	for _, c := range cursors {
+		c.bound = scorer.bound(c.word, c.title)
+	}
+
+	for {
+		active := cursors[:0]
+		for _, c := range cursors {
+			if !c.done() {
+				active = append(active, c)
+			}
+		}
+		cursors = active
+		if len(cursors) == 0 {
+			break
+		}
+		sort.Slice(cursors, func(i, j int) bool {
+			return cursors[i].current().PageId < cursors[j].current().PageId
+		})
+
+		// Pages are scored at a threshold below any score until k pages are found
+		threshold := -1.0
+		if best.Len() == k {
+			threshold = (*best)[0].score
+		}
+
+		// The pivot is the first page whose lists could beat the threshold
+		pivot, sum := -1, 0.0
+		for i, c := range cursors {
+			sum += c.bound
+			if sum > threshold {
+				pivot = i
+				break
+			}
+		}
+		if pivot < 0 {
+			break
+		}
+		pivotId := cursors[pivot].current().PageId
+
+		if cursors[0].current().PageId != pivotId {
+			// Pages before the pivot cannot beat the threshold
+			for _, c := range cursors[:pivot] {
+				c.seek(pivotId)
+			}
+			continue
+		}
+
+		matches := make([]*postingCursor, 0)
+		for _, c := range cursors {
+			if c.current().PageId != pivotId {
+				break
+			}
+			matches = append(matches, c)
+		}
+
+		page := scoredPage{pivotId, scorer.score(pivotId, matches)}
+		if best.Len() < k {
+			heap.Push(best, page)
+		} else if ranksBelow((*best)[0], page) {
+			(*best)[0] = page
+			heap.Fix(best, 0)
+		}
+
+		for _, c := range matches {
+			c.pos++
+		}
+	}
+
+	scores := make(map[uint64]float64)
+	ids := make([]uint64, best.Len())
+	for i := best.Len() - 1; i >= 0; i-- {
+		page := heap.Pop(best).(scoredPage)
+		scores[page.id] = page.score
+		ids[i] = page.id
+	}
+	return scores, ids
+}
+
+// Returns the pages in any of the posting lists in ascending order
+func matchingPages(index *database.QueryIndex) []uint64 {
+	ids := make([]uint64, 0)
+	for _, lists := range []map[string][]database.Posting{index.Body, index.Title} {
+		for _, postings := range lists {
+			pageIds := make([]uint64, len(postings))
+			for i, p := range postings {
+				pageIds[i] = p.PageId
+			}
+			ids = union(ids, pageIds)
+		}
+	}
+	return ids
+}
+
+// Returns the scorer for the ranking model of the options, and new cursors over the
+// posting lists of the query words
+func newWand(query []string, index *database.QueryIndex, stats func(pageId uint64) database.PageStats, opts Options) (pageScorer, []*postingCursor) {
+	counts := make(map[string]int)
+	for _, word := range query {
+		counts[word]++
+	}
+
+	var scorer pageScorer
+	switch opts.Model {
+	case BM25, BM25F:
+		titleWeight := 0.0
+		if opts.Model == BM25F {
+			titleWeight = opts.TitleBoost
+		}
+
+		// BM25F counts a page towards the df if either field contains the word
+		idf := make(map[string]float64)
+		for word := range counts {
+			df := len(index.Body[word])
+			if titleWeight != 0 {
+				df = countPages(index.Body[word], index.Title[word])
+			}
+			idf[word] = bm25Idf(index.NumPages, df)
+		}
+		scorer = &bm25Scorer{index, stats, counts, idf, titleWeight}
+	default:
+		scorer = &vspaceScorer{index, stats, counts, math.Sqrt(float64(len(query))), opts.TitleBoost}
+	}
+
+	cursors := make([]*postingCursor, 0)
+	for word := range counts {
+		cursors = append(cursors,
+			&postingCursor{word: word, postings: index.Body[word]},
+			&postingCursor{word: word, title: true, postings: index.Title[word]})
+	}
+	return scorer, cursors
+}
+
+// Returns the k best pages for the query words with their scores, best first,
+// and the number of pages containing any of the words.
+// Ranks with the model of the options like vspaceRetrieval, without scoring every page.
+func topKRetrieval(query []string, viewer *database.Viewer, k int, opts Options) (scores map[uint64]float64, ids []uint64, matches int) {
+	viewer.ScanQuery(query, func(index *database.QueryIndex, stats func(pageId uint64) database.PageStats) {
+		scorer, cursors := newWand(query, index, stats, opts)
+		scores, ids = wand(cursors, scorer, k)
+		matches = len(matchingPages(index))
+	})
+	return
+}
@@ -0,0 +1,80 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/rsmohamad/comp4321/stopword"
+	"github.com/surgebase/porter2"
+)
+
+// Han characters are written without spaces, so each one is a word
+func isHan(r rune) bool {
+	return unicode.Is(unicode.Han, r)
+}
+
+// Split text into words of letters and digits in any script.
+// Everything else separates words.
+func Split(text string) (rv []string) {
+	rv, _ = splitOffsets(text)
+	return
+}
+
+// Returns the words of text as Split does, with the byte offset of each one
+func splitOffsets(text string) (rv []string, offsets []int) {
+	start := -1
+	for i, r := range text {
+		if isHan(r) {
+			if start >= 0 {
+				rv, offsets = append(rv, text[start:i]), append(offsets, start)
+				start = -1
+			}
+			rv, offsets = append(rv, string(r)), append(offsets, i)
+			continue
+		}
+
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r) {
+			if start < 0 {
+				start = i
+			}
+		} else if start >= 0 {
+			rv, offsets = append(rv, text[start:i]), append(offsets, start)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		rv, offsets = append(rv, text[start:]), append(offsets, start)
+	}
+	return
+}
+
+// The English stemmer only applies to words in the Latin script
+func isLatin(word string) bool {
+	for _, r := range word {
+		if r >= unicode.MaxASCII && !unicode.Is(unicode.Latin, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the lower cased and stemmed words of text, without stopwords
+func Tokenize(text string) (rv []string) {
+	rv, _ = TokenizeOffsets(text)
+	return
+}
+
+// Returns the words of text as Tokenize does, with the byte offset of each one in text
+func TokenizeOffsets(text string) (rv []string, offsets []int) {
+	words, wordOffsets := splitOffsets(text)
+	for i, word := range words {
+		cleaned := strings.ToLower(word)
+		if isLatin(cleaned) {
+			cleaned = porter2.Stem(cleaned)
+		}
+		if !stopword.IsStopWord(cleaned) {
+			rv, offsets = append(rv, cleaned), append(offsets, wordOffsets[i])
+		}
+	}
+	return
+}
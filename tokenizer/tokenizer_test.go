@@ -0,0 +1,42 @@
+package tokenizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	testcases := []struct {
+		text     string
+		expected []string
+	}{
+		{"hello, world!", []string{"hello", "world"}},
+		{"café au-lait 2018", []string{"café", "au", "lait", "2018"}},
+		{"Ελληνικά и русский", []string{"Ελληνικά", "и", "русский"}},
+		{"搜索引擎abc", []string{"搜", "索", "引", "擎", "abc"}},
+		{"  ", nil},
+	}
+
+	for _, tc := range testcases {
+		if words := Split(tc.text); !reflect.DeepEqual(words, tc.expected) {
+			t.Log(tc.text, words)
+			t.Fail()
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	words := Tokenize("Crawling CAFÉS Москва")
+	expected := []string{"crawl", "café", "москва"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Log(words)
+		t.Fail()
+	}
+}
+
+func TestTokenizeOffsets(t *testing.T) {
+	words, offsets := TokenizeOffsets(" Crawling, CAFÉS")
+	if !reflect.DeepEqual(words, []string{"crawl", "café"}) || !reflect.DeepEqual(offsets, []int{1, 11}) {
+		t.Error("Wrong tokens or offsets", words, offsets)
+	}
+}
@@ -0,0 +1,149 @@
+package webcrawler
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Rules for the query parameters of canonical URLs.
+// Parameters are matched case-insensitively, a trailing * matches any suffix.
+// If Keep is given, only the parameters it matches are kept.
+// Remaining parameters are sorted by name.
+type QueryRules struct {
+	Drop []string `json:"drop"`
+	Keep []string `json:"keep"`
+}
+
+// Returns rules that drop tracking and session parameters
+func DefaultQueryRules() QueryRules {
+	return QueryRules{
+		Drop: []string{"utm_*", "fbclid", "gclid", "sessionid", "jsessionid", "phpsessid", "sid"},
+	}
+}
+
+// Rules used by canonicalise, set by Crawl from the scope
+var queryRules = DefaultQueryRules()
+
+// File names served for a directory
+var indexFiles = []string{"index.html", "index.htm"}
+
+func matchesParam(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(name, pattern[:len(pattern)-1]) {
+			return true
+		}
+		if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (r QueryRules) keeps(name string) bool {
+	if matchesParam(name, r.Drop) {
+		return false
+	}
+	return len(r.Keep) == 0 || matchesParam(name, r.Keep)
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// Decode escaped unreserved characters and upper case the remaining escapes
+func normaliseEscapes(s string) string {
+	rv := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			if c := unhex(s[i+1])<<4 | unhex(s[i+2]); isUnreserved(c) {
+				rv = append(rv, c)
+			} else {
+				rv = append(rv, '%')
+				rv = append(rv, strings.ToUpper(s[i+1:i+3])...)
+			}
+			i += 2
+			continue
+		}
+		rv = append(rv, s[i])
+	}
+	return string(rv)
+}
+
+// Remove dot segments, duplicate slashes and index file names from the path
+func normalisePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	for _, name := range indexFiles {
+		if strings.HasSuffix(p, "/"+name) {
+			p = strings.TrimSuffix(p, name)
+		}
+	}
+
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// Keep the parameters allowed by the rules, sorted by name
+func normaliseQuery(rawQuery string) string {
+	values, _ := url.ParseQuery(rawQuery)
+	for name := range values {
+		if !queryRules.keeps(name) {
+			delete(values, name)
+		}
+	}
+
+	// Encode sorts by name and escapes everything but unreserved characters
+	return values.Encode()
+}
+
+// Returns the canonical form of an absolute http or https URL, or "" if it has none.
+// Keeps the scheme, port and query. Lower cases the host, drops the default port
+// and the fragment, normalises percent-encoding and removes dot segments.
+// Query parameters are filtered by queryRules.
+func canonicalise(link string) string {
+	uri, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (uri.Scheme != "http" && uri.Scheme != "https") || uri.Host == "" {
+		return ""
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(uri.Hostname()), ".")
+	port := uri.Port()
+	if (uri.Scheme == "http" && port == "80") || (uri.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	rv := uri.Scheme + "://" + host + normalisePath(normaliseEscapes(uri.EscapedPath()))
+	if query := normaliseQuery(uri.RawQuery); query != "" {
+		rv += "?" + query
+	}
+	return rv
+}
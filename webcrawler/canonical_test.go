@@ -0,0 +1,58 @@
+package webcrawler
+
+import "testing"
+
+func TestCanonicalise(t *testing.T) {
+	testcases := []struct {
+		link, expected string
+	}{
+		{"http://www.cse.ust.hk", "http://www.cse.ust.hk/"},
+		{"  HTTP://WWW.CSE.UST.HK/ug/  ", "http://www.cse.ust.hk/ug/"},
+		{"https://cse.ust.hk:443/a", "https://cse.ust.hk/a"},
+		{"http://cse.ust.hk:80/a", "http://cse.ust.hk/a"},
+		{"http://cse.ust.hk:8080/a", "http://cse.ust.hk:8080/a"},
+		{"https://cse.ust.hk:80/a", "https://cse.ust.hk:80/a"},
+		{"http://cse.ust.hk./a", "http://cse.ust.hk/a"},
+		{"http://[::1]/a", "http://[::1]/a"},
+		{"http://cse.ust.hk/a/./b/../c", "http://cse.ust.hk/a/c"},
+		{"http://cse.ust.hk//a//b/", "http://cse.ust.hk/a/b/"},
+		{"http://cse.ust.hk/ug/index.html", "http://cse.ust.hk/ug/"},
+		{"http://cse.ust.hk/index.htm", "http://cse.ust.hk/"},
+		{"http://cse.ust.hk/a#section", "http://cse.ust.hk/a"},
+		{"http://cse.ust.hk/%7euser/%2f%e4", "http://cse.ust.hk/~user/%2F%E4"},
+		{"http://cse.ust.hk/a?b=2&a=1", "http://cse.ust.hk/a?a=1&b=2"},
+		{"http://cse.ust.hk/a?utm_source=x&id=1&SID=2", "http://cse.ust.hk/a?id=1"},
+		{"http://cse.ust.hk/a?utm_source=x", "http://cse.ust.hk/a"},
+		{"ftp://cse.ust.hk/a", ""},
+		{"mailto:admin@cse.ust.hk", ""},
+		{"/relative/path", ""},
+		{"http://", ""},
+		{"http://cse.ust.hk/%zz", ""},
+	}
+
+	for _, tc := range testcases {
+		if rv := canonicalise(tc.link); rv != tc.expected {
+			t.Errorf("canonicalise(%q) = %q, expected %q", tc.link, rv, tc.expected)
+		}
+	}
+}
+
+func TestQueryRules(t *testing.T) {
+	defer func() { queryRules = DefaultQueryRules() }()
+
+	testcases := []struct {
+		rules          QueryRules
+		link, expected string
+	}{
+		{QueryRules{}, "http://a.com/?utm_source=x&b=1", "http://a.com/?b=1&utm_source=x"},
+		{QueryRules{Keep: []string{"id"}}, "http://a.com/?ID=1&page=2", "http://a.com/?ID=1"},
+		{QueryRules{Drop: []string{"p*"}, Keep: []string{"page", "q"}}, "http://a.com/?page=2&q=x", "http://a.com/?q=x"},
+	}
+
+	for _, tc := range testcases {
+		queryRules = tc.rules
+		if rv := canonicalise(tc.link); rv != tc.expected {
+			t.Errorf("canonicalise(%q) with %v = %q, expected %q", tc.link, tc.rules, rv, tc.expected)
+		}
+	}
+}
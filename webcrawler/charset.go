@@ -0,0 +1,29 @@
+package webcrawler
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+var utf8Bom = []byte("\xef\xbb\xbf")
+
+// Convert a text body to UTF-8.
+// The charset is taken from a byte order mark, the Content-Type header or
+// a <meta charset> tag, in that order. Bodies without a charset are taken
+// as UTF-8 if they are valid UTF-8 and as windows-1252 otherwise.
+func toUTF8(body []byte, contentType string) []byte {
+	encoding, name, certain := charset.DetermineEncoding(body, contentType)
+
+	// Only the start of the body is checked for UTF-8
+	if name == "utf-8" || (!certain && name == "windows-1252" && utf8.Valid(body)) {
+		return bytes.TrimPrefix(body, utf8Bom)
+	}
+
+	decoded, err := encoding.NewDecoder().Bytes(body)
+	if err != nil {
+		return body
+	}
+	return decoded
+}
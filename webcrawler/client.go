@@ -10,15 +10,17 @@ var tr = &http.Transport{
 	MaxIdleConnsPerHost: 1024,
 	TLSHandshakeTimeout: 0 * time.Second,
 }
+
+// Requests to a host are 100ms apart and at most 2 at a time
+var politeness = newScheduler(time.Millisecond*100, 2)
+
 var fetchClient = http.Client{
 	Timeout:   time.Second * 30,
-	Transport: tr,
+	Transport: &politeTransport{base: tr, sched: politeness},
 }
 
 var robotClient = http.Client{Timeout: time.Second * 5}
 
-var throttle = time.Tick(time.Millisecond * 100)
-
 func initClients(aggressive bool) {
 	if !aggressive {
 		return
@@ -31,10 +33,11 @@ func initClients(aggressive bool) {
 		TLSHandshakeTimeout: 0 * time.Second,
 	}
 
+	// Crawl-delay in robots.txt is still obeyed
+	politeness = newScheduler(time.Millisecond*1, 16)
+
 	fetchClient = http.Client{
 		Timeout:   time.Second * 5,
-		Transport: tr,
+		Transport: &politeTransport{base: tr, sched: politeness},
 	}
-
-	throttle = time.Tick(time.Millisecond * 1)
 }
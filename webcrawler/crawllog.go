@@ -0,0 +1,164 @@
+package webcrawler
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Outcomes of the URLs in the crawl log
+const (
+	outcomeIndexed   = "indexed"
+	outcomeUnchanged = "unchanged"
+	outcomeDeleted   = "deleted"
+	outcomeSkipped   = "skipped"
+	outcomeFailed    = "failed"
+	outcomeSitemap   = "sitemap"
+)
+
+// Line of the crawl log for one URL, a page or a sitemap.
+// Skipped and failed URLs have the reason, e.g. "disallowed by robots.txt".
+// Indexed pages that are near duplicates have the URL of their representative,
+// as only the representative is shown in search results.
+type logEntry struct {
+	Time        time.Time `json:"time"`
+	Url         string    `json:"url"`
+	Depth       int       `json:"depth"`
+	Status      int       `json:"status,omitempty"`
+	Bytes       int       `json:"bytes"`
+	LatencyMs   float64   `json:"latencyMs"`
+	ContentType string    `json:"contentType,omitempty"`
+	Outcome     string    `json:"outcome"`
+	Reason      string    `json:"reason,omitempty"`
+	Retries     int       `json:"retries,omitempty"`
+	DuplicateOf string    `json:"duplicateOf,omitempty"`
+}
+
+// Counts of the URLs of one host
+type HostSummary struct {
+	Urls     int            `json:"urls"`
+	Bytes    int64          `json:"bytes"`
+	Outcomes map[string]int `json:"outcomes"`
+}
+
+// Summary of a crawl.
+// Errors counts the URLs that were skipped or failed by reason.
+// Throughput counts the indexed and unchanged pages.
+type CrawlSummary struct {
+	Start          time.Time               `json:"start"`
+	End            time.Time               `json:"end"`
+	Seconds        float64                 `json:"seconds"`
+	Urls           int                     `json:"urls"`
+	Bytes          int64                   `json:"bytes"`
+	Outcomes       map[string]int          `json:"outcomes"`
+	Errors         map[string]int          `json:"errors"`
+	Hosts          map[string]*HostSummary `json:"hosts"`
+	PagesPerSecond float64                 `json:"pagesPerSecond"`
+	BytesPerSecond float64                 `json:"bytesPerSecond"`
+	MeanLatencyMs  float64                 `json:"meanLatencyMs"`
+}
+
+// Log of the URLs visited by Crawl, written as JSON lines.
+// A nil CrawlLog records nothing.
+// Thread safe.
+type CrawlLog struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+	summary CrawlSummary
+
+	// Total latency of the URLs that were requested
+	latency   time.Duration
+	requested int
+}
+
+// Returns a log writing to w.
+// If w is nil, only the summary is kept.
+func NewCrawlLog(w io.Writer) *CrawlLog {
+	l := &CrawlLog{}
+	if w != nil {
+		l.encoder = json.NewEncoder(w)
+	}
+	l.summary = CrawlSummary{
+		Start:    time.Now(),
+		Outcomes: make(map[string]int),
+		Errors:   make(map[string]int),
+		Hosts:    make(map[string]*HostSummary),
+	}
+	return l
+}
+
+// Write the entry of a fetch result and add it to the summary
+func (l *CrawlLog) record(result fetchResult, outcome string) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	entry := logEntry{
+		Time:        time.Now(),
+		Url:         result.uri,
+		Depth:       result.depth,
+		Status:      result.status,
+		Bytes:       result.bytes,
+		LatencyMs:   result.latency.Seconds() * 1000,
+		ContentType: result.contentType,
+		Outcome:     outcome,
+		Retries:     result.retries,
+		DuplicateOf: result.duplicateOf,
+	}
+	if outcome == outcomeSkipped || outcome == outcomeFailed {
+		entry.Reason = result.reason
+		l.summary.Errors[result.reason]++
+	}
+	if l.encoder != nil {
+		l.encoder.Encode(entry)
+	}
+
+	host := getHost(result.uri)
+	hostSummary, found := l.summary.Hosts[host]
+	if !found {
+		hostSummary = &HostSummary{Outcomes: make(map[string]int)}
+		l.summary.Hosts[host] = hostSummary
+	}
+	hostSummary.Urls++
+	hostSummary.Bytes += int64(result.bytes)
+	hostSummary.Outcomes[outcome]++
+
+	l.summary.Urls++
+	l.summary.Bytes += int64(result.bytes)
+	l.summary.Outcomes[outcome]++
+	if result.latency > 0 {
+		l.latency += result.latency
+		l.requested++
+	}
+}
+
+// Returns the summary of the URLs recorded so far
+func (l *CrawlLog) Summary() CrawlSummary {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	summary := l.summary
+	summary.End = time.Now()
+	summary.Seconds = summary.End.Sub(summary.Start).Seconds()
+	if summary.Seconds > 0 {
+		pages := summary.Outcomes[outcomeIndexed] + summary.Outcomes[outcomeUnchanged]
+		summary.PagesPerSecond = float64(pages) / summary.Seconds
+		summary.BytesPerSecond = float64(summary.Bytes) / summary.Seconds
+	}
+	if l.requested > 0 {
+		summary.MeanLatencyMs = l.latency.Seconds() * 1000 / float64(l.requested)
+	}
+	return summary
+}
+
+// Write the summary to w as indented JSON
+func (l *CrawlLog) WriteSummary(w io.Writer) error {
+	out, err := json.MarshalIndent(l.Summary(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(out, '\n'))
+	return err
+}
@@ -0,0 +1,46 @@
+package webcrawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestCrawlLog(t *testing.T) {
+	var out bytes.Buffer
+	crawlLog := NewCrawlLog(&out)
+
+	indexed := fetchResult{uri: "http://a.com/1", duplicateOf: "http://a.com/"}
+	indexed.status, indexed.bytes, indexed.retries = 200, 10, 2
+	crawlLog.record(indexed, outcomeIndexed)
+	sitemap := fetchResult{uri: "http://a.com/sitemap.xml"}
+	sitemap.status, sitemap.bytes = 200, 5
+	crawlLog.record(sitemap, outcomeSitemap)
+	failed := fetchResult{uri: "http://b.com/sitemap.xml"}
+	failed.status, failed.reason = 404, "HTTP 404"
+	crawlLog.record(failed, outcomeFailed)
+
+	decoder := json.NewDecoder(&out)
+	entries := make([]logEntry, 0)
+	for decoder.More() {
+		var entry logEntry
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 3 {
+		t.Fatal("Expected 3 entries, got", entries)
+	}
+	if entries[0].DuplicateOf != "http://a.com/" || entries[0].Retries != 2 || entries[0].Outcome != outcomeIndexed {
+		t.Error("Wrong indexed entry", entries[0])
+	}
+	if entries[1].Outcome != outcomeSitemap || entries[1].Reason != "" || entries[2].Reason != "HTTP 404" {
+		t.Error("Wrong sitemap entries", entries[1:])
+	}
+
+	summary := crawlLog.Summary()
+	if summary.Urls != 3 || summary.Bytes != 15 || summary.Errors["HTTP 404"] != 1 || summary.Hosts["a.com"].Urls != 2 {
+		t.Error("Wrong summary", summary)
+	}
+}
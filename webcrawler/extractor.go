@@ -0,0 +1,226 @@
+package webcrawler
+
+import (
+	"bytes"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"mvdan.cc/xurls"
+)
+
+// Largest response body that is read, longer bodies are cut off
+const maxBodySize = 32 << 20
+
+// Content of a fetched document.
+// Links may be relative to the URL of the document.
+type Content struct {
+	Title string
+	Text  string
+	Links []string
+
+	// URL of a <link rel="canonical"> or similar, if any
+	Canonical string
+
+	// URL the document redirects to instead of having content, if any
+	Redirect string
+}
+
+// Extracts the content of documents of one media type.
+// contentType is the full Content-Type header, including any charset.
+// Implementations must be safe for concurrent use.
+type Extractor interface {
+	Extract(body []byte, contentType string, uri *url.URL) (*Content, error)
+}
+
+// Extractors by media type
+var extractors = map[string]Extractor{
+	"text/html":            htmlExtractor{},
+	"text/plain":           textExtractor{},
+	"application/pdf":      pdfExtractor{},
+	"application/rss+xml":  feedExtractor{},
+	"application/atom+xml": feedExtractor{},
+	"application/xml":      feedExtractor{},
+	"text/xml":             feedExtractor{},
+}
+
+// Register an extractor for a media type, replacing the existing one.
+// Must be called before crawling.
+func RegisterExtractor(mediaType string, extractor Extractor) {
+	extractors[strings.ToLower(mediaType)] = extractor
+}
+
+// Returns the extractor for the media type of the Content-Type, or nil if there is none
+func getExtractor(contentType string) Extractor {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	return extractors[mediaType]
+}
+
+// Title for documents without one, taken from the file name
+func titleFromUrl(uri *url.URL) string {
+	name := path.Base(uri.Path)
+	if name == "/" || name == "." {
+		return uri.Hostname()
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
+
+// Get url from html token
+func getUrl(t html.Token) string {
+	// Iterate over all attributes
+	for _, a := range t.Attr {
+		if a.Key == "href" {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// Returns the URL of a <meta http-equiv="refresh" content="0; url=..."> tag.
+// The URL may be relative.
+func handleMetaRedirect(t html.Token) (url string, redirect bool) {
+	var content string
+	for _, a := range t.Attr {
+		if a.Key == "http-equiv" && strings.EqualFold(a.Val, "refresh") {
+			redirect = true
+		}
+		if a.Key == "content" {
+			content = a.Val
+		}
+	}
+
+	// A refresh without URL reloads the page itself
+	idx := strings.Index(content, ";")
+	if !redirect || idx < 0 {
+		return "", false
+	}
+	url = strings.TrimSpace(content[idx+1:])
+	if len(url) >= 4 && strings.EqualFold(url[:4], "url=") {
+		url = strings.TrimSpace(url[4:])
+	}
+	url = strings.Trim(url, "\"'")
+	return url, url != ""
+}
+
+// Returns the href of a <link rel="canonical"> tag
+func getCanonical(t html.Token) (href string, canonical bool) {
+	for _, a := range t.Attr {
+		if a.Key == "rel" {
+			for _, rel := range strings.Fields(strings.ToLower(a.Val)) {
+				canonical = canonical || rel == "canonical"
+			}
+		}
+		if a.Key == "href" {
+			href = a.Val
+		}
+	}
+	return
+}
+
+// Extracts the title, body text and body links of HTML pages
+type htmlExtractor struct{}
+
+func (htmlExtractor) Extract(body []byte, contentType string, uri *url.URL) (*Content, error) {
+	body = toUTF8(body, contentType)
+	content := &Content{}
+	words := make([]string, 0)
+	var lastElement string
+	inBody := false
+
+	// Tokenize
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+
+	// Loop through all html elements
+	for {
+		tokenType := tokenizer.Next()
+		t := tokenizer.Token()
+
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		switch tokenType {
+		case html.StartTagToken:
+			// Indicate when inside body tags
+			if t.Data == "body" {
+				inBody = true
+			}
+			// Title
+			if t.Data == "title" {
+				tokenizer.Next()
+				content.Title = strings.TrimSpace(tokenizer.Token().Data)
+			}
+			// Links
+			if t.Data == "a" && inBody {
+				content.Links = append(content.Links, getUrl(t))
+			}
+			if t.Data == "link" {
+				if href, canonical := getCanonical(t); canonical {
+					content.Canonical = href
+				}
+			}
+			// Meta tags are usually written without a closing slash
+			if t.Data == "meta" {
+				if link, redirect := handleMetaRedirect(t); redirect {
+					content.Redirect = link
+					return content, nil
+				}
+			}
+			lastElement = t.Data
+			break
+		case html.SelfClosingTagToken:
+			if t.Data == "link" {
+				if href, canonical := getCanonical(t); canonical {
+					content.Canonical = href
+				}
+			}
+			if t.Data == "meta" {
+				link, redirect := handleMetaRedirect(t)
+				if redirect {
+					content.Redirect = link
+					return content, nil
+				}
+				break
+			}
+			break
+		case html.TextToken:
+			// Skip if text is empty, not in between body tags or between script tags
+			trimmed := strings.TrimSpace(t.Data)
+			if trimmed != "" && inBody && lastElement != "script" && lastElement != "style" {
+				words = append(words, trimmed)
+			}
+		}
+	}
+
+	content.Text = strings.Join(words, " ")
+	return content, nil
+}
+
+// Extracts plain text documents.
+// The title is the first line, and URLs in the text are followed.
+type textExtractor struct{}
+
+// Longest first line used as the title of a plain text document
+const maxTextTitle = 100
+
+func (textExtractor) Extract(body []byte, contentType string, uri *url.URL) (*Content, error) {
+	content := &Content{Text: string(toUTF8(body, contentType)), Title: titleFromUrl(uri)}
+	for _, line := range strings.Split(content.Text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if len(line) <= maxTextTitle {
+				content.Title = line
+			}
+			break
+		}
+	}
+	content.Links = xurls.Strict().FindAllString(content.Text, -1)
+	return content, nil
+}
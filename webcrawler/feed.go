@@ -0,0 +1,100 @@
+package webcrawler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Extracts RSS and Atom feeds.
+// The text is all character data, the title is the first <title> element,
+// and links are the text of RSS <link> elements or the href of Atom ones.
+// Other XML documents, such as sitemaps, are rejected.
+type feedExtractor struct{}
+
+// Root elements of RSS 2.0, Atom and RSS 1.0 feeds
+var feedRoots = map[string]bool{"rss": true, "feed": true, "RDF": true}
+
+// Returns true if body starts with an XML declaration naming its encoding
+func declaresEncoding(body []byte) bool {
+	body = bytes.TrimPrefix(body, utf8Bom)
+	end := bytes.Index(body, []byte("?>"))
+	return bytes.HasPrefix(body, []byte("<?xml")) && end > 0 && bytes.Contains(body[:end], []byte("encoding"))
+}
+
+// The charset is taken from the XML declaration, or else detected like that of other documents.
+func (feedExtractor) Extract(body []byte, contentType string, uri *url.URL) (*Content, error) {
+	content := &Content{}
+	words := make([]string, 0)
+	var element string
+	started := false
+
+	charsetReader := charset.NewReaderLabel
+	if !declaresEncoding(body) {
+		// Converted bodies are UTF-8 whatever a declaration of a byte order marked body says
+		body = toUTF8(body, contentType)
+		charsetReader = func(label string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.CharsetReader = charsetReader
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if !started && !feedRoots[t.Name.Local] {
+				return nil, errors.New("not a feed: <" + t.Name.Local + ">")
+			}
+			started = true
+			element = t.Name.Local
+			if element == "link" {
+				for _, a := range t.Attr {
+					if a.Name.Local == "href" {
+						content.Links = append(content.Links, a.Value)
+					}
+				}
+			}
+		case xml.EndElement:
+			element = ""
+		case xml.CharData:
+			trimmed := strings.TrimSpace(string(t))
+			if trimmed == "" {
+				continue
+			}
+			switch element {
+			case "title":
+				if content.Title == "" {
+					content.Title = trimmed
+				}
+			case "link":
+				content.Links = append(content.Links, trimmed)
+				continue
+			}
+			words = append(words, trimmed)
+		}
+	}
+
+	if !started {
+		return nil, errors.New("not a feed: no root element")
+	}
+	if content.Title == "" {
+		content.Title = titleFromUrl(uri)
+	}
+	content.Text = strings.Join(words, " ")
+	return content, nil
+}
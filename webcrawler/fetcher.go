@@ -2,109 +2,135 @@ package webcrawler
 
 import (
 	"github.com/rsmohamad/comp4321/models"
-	"github.com/rsmohamad/comp4321/stopword"
+	"github.com/rsmohamad/comp4321/tokenizer"
+	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
 	"time"
 
 	"fmt"
-	"github.com/surgebase/porter2"
-	"golang.org/x/net/html"
 	"io"
 	"io/ioutil"
-	"mvdan.cc/xurls"
 )
 
-// Get url from html token
-func getUrl(t html.Token) string {
-	// Iterate over all attributes
-	for _, a := range t.Attr {
-		if a.Key == "href" {
-			return a.Val
-		}
+// Resolve link against base and return its canonical form, see canonical.go.
+// Returns "" for links that cannot be crawled.
+func resolveUrl(link string, baseUrl *url.URL) string {
+	uri, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ""
 	}
-	return ""
-}
 
-func handleMetaRedirect(t html.Token) (url string, redirect bool) {
-	redirect = false
-	for _, a := range t.Attr {
-		if a.Key == "http-equiv" && a.Val == "refresh" {
-			redirect = true
-		}
-		if a.Key == "content" && redirect {
-			url = xurls.Strict().FindString(a.Val)
-		}
+	if !uri.IsAbs() {
+		uri = baseUrl.ResolveReference(uri)
 	}
-	return
+	return canonicalise(uri.String())
 }
 
-// Fix relative URL to absolute URL
+// Fix relative URL to absolute canonical URL
 func toAbsoluteUrl(links []string, base string) (rv []string) {
 	baseUrl, _ := url.Parse(base)
 	for _, link := range links {
-		uri, err := url.Parse(link)
-
-		if err != nil {
-			continue
-		}
-
-		if !uri.IsAbs() {
-			uri = baseUrl.ResolveReference(uri)
-		}
+		newUrl := resolveUrl(link, baseUrl)
 
-		// Skip PDFs
-		if strings.HasSuffix(strings.ToLower(uri.Path), ".pdf") {
+		if newUrl == "" {
 			continue
 		}
 
-		if strings.HasPrefix(uri.String(), "http") {
-			newUrl := "http://" + uri.Host + uri.Path
-			rv = append(rv, newUrl)
-		}
+		rv = append(rv, newUrl)
 	}
 	return
 }
 
 // Clean and tokenize string
-func tokenizeString(s string) (rv []string) {
-	regex := regexp.MustCompile("[^a-zA-Z0-9 ]")
-	s = regex.ReplaceAllString(s, " ")
-	regex = regexp.MustCompile("[^\\s]+")
-	words := regex.FindAllString(s, -1)
-	for _, word := range words {
-		cleaned := strings.ToLower(word)
-		cleaned = strings.TrimSpace(cleaned)
-		cleaned = porter2.Stem(cleaned)
-		if !stopword.IsStopWord(cleaned) {
-			rv = append(rv, cleaned)
-		}
-	}
-	return
+func tokenizeString(s string) []string {
+	return tokenizer.Tokenize(s)
 }
 
+// Fetch and parse the page at uri.
+// Returns nil if the page cannot be fetched or its Content-Type is not supported.
 func Fetch(uri string) (page *models.Document) {
-	words := make([]string, 0)
-	var lastElement string
+	page, _ = FetchIfModified(uri, nil)
+	return
+}
+
+// Fetch the page at uri only if it changed since prev was fetched.
+// Sends If-Modified-Since and If-None-Match built from prev.Modtime and prev.ETag.
+// Also returns the HTTP status code, which is 0 if the request failed.
+// A 304 Not Modified status is returned with a nil page.
+// Returns a nil page if no extractor handles the Content-Type, see extractor.go.
+func FetchIfModified(uri string, prev *models.Document) (page *models.Document, status int) {
+	page, info := politeFetch(uri, prev)
+	return page, info.status
+}
+
+// Details of a fetch for the crawl log, see crawllog.go.
+// Reason tells why no page was returned.
+type fetchInfo struct {
+	status      int
+	contentType string
+	bytes       int
+	latency     time.Duration
+	reason      string
+
+	// Number of times the page was requested again because the server was overloaded
+	retries int
+
+	// Canonical URL of a meta refresh, which politeFetch follows
+	refresh string
+}
+
+// Same as FetchIfModified, but returns the details of the fetch.
+// Meta refreshes are returned in info.refresh with a nil page.
+func fetchPage(uri string, prev *models.Document) (page *models.Document, info fetchInfo) {
 	page = &models.Document{Uri: uri}
-	inBody := false
+	start := time.Now()
+	defer func() {
+		info.latency = time.Since(start)
+	}()
+
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		fmt.Println(err)
+		info.reason = "invalid request"
+		return nil, info
+	}
+
+	// Conditional request headers
+	if prev != nil {
+		if prev.Modtime > 0 {
+			req.Header.Set("If-Modified-Since", time.Unix(prev.Modtime, 0).UTC().Format(http.TimeFormat))
+		}
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+	}
 
 	// Make HTTP GET request
-	res, err := fetchClient.Get(uri)
+	res, err := fetchClient.Do(req)
 
 	if err != nil {
 		fmt.Println(err)
-		return nil
+		info.reason = "request failed"
+		if urlErr, ok := err.(*url.Error); ok && urlErr.Err == errRedirectDisallowed {
+			info.reason = reasonRobots
+		}
+		return nil, info
 	}
+	defer res.Body.Close()
+	info.status = res.StatusCode
+	info.contentType = res.Header.Get("Content-Type")
 
 	// Return if HTTP request is not successful
-	if res == nil || res.StatusCode != 200 {
-		return nil
+	if info.status != 200 {
+		info.reason = fmt.Sprintf("HTTP %d", info.status)
+		return nil, info
 	}
 
-	if res.Header.Get("Content-Type") != "text/html" {
-		return nil
+	extractor := getExtractor(info.contentType)
+	if extractor == nil {
+		info.reason = "unsupported content type"
+		return nil, info
 	}
 
 	tm, _ := time.Parse(time.RFC1123, res.Header.Get("Last-Modified"))
@@ -113,65 +139,60 @@ func Fetch(uri string) (page *models.Document) {
 		tm, _ = time.Parse(time.RFC1123, res.Header.Get("Date"))
 		page.Modtime = tm.Unix()
 	}
-	page.Len = 0
+	page.ETag = res.Header.Get("ETag")
 
-	// Tokenize
-	tokenizer := html.NewTokenizer(res.Body)
-	defer res.Body.Close()
+	// Pages are known by the canonical form of the URL they were redirected to
+	finalUrl := res.Request.URL
+	if canonical := canonicalise(finalUrl.String()); canonical != "" {
+		page.Uri = canonical
+	}
 
-	// Loop through all html elements
-	for {
-		tokenType := tokenizer.Next()
-		t := tokenizer.Token()
-		page.Len += len(tokenizer.Raw())
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	info.bytes = len(body)
+	if err != nil {
+		fmt.Println(err)
+		info.reason = "body read failed"
+		return nil, info
+	}
+	page.Len = len(body)
 
-		if tokenType == html.ErrorToken {
-			break
+	content, err := extractor.Extract(body, info.contentType, finalUrl)
+	if err != nil {
+		fmt.Println(uri, err)
+		info.reason = "extraction failed"
+		return nil, info
+	}
+	if content.Redirect != "" {
+		info.refresh = resolveUrl(content.Redirect, finalUrl)
+		info.reason = "meta refresh"
+		if info.refresh == "" {
+			info.reason = "invalid meta refresh"
 		}
+		return nil, info
+	}
 
-		switch tokenType {
-		case html.StartTagToken:
-			// Indicate when inside body tags
-			if t.Data == "body" {
-				inBody = true
-			}
-			// Title
-			if t.Data == "title" {
-				tokenizer.Next()
-				page.Title = strings.TrimSpace(tokenizer.Token().Data)
-			}
-			// Links
-			if t.Data == "a" && inBody {
-				page.Links = append(page.Links, getUrl(t))
-			}
-			lastElement = t.Data
-			break
-		case html.SelfClosingTagToken:
-			if t.Data == "meta" {
-				link, redirect := handleMetaRedirect(t)
-				if redirect {
-					return Fetch(link)
-				}
-				break
-			}
-			break
-		case html.TextToken:
-			// Skip if text is empty, not in between body tags or between script tags
-			trimmed := strings.TrimSpace(t.Data)
-			if trimmed != "" && inBody && lastElement != "script" && lastElement != "style" {
-				words = append(words, trimmed)
-			}
+	// Honour rel="canonical" within the same host
+	if content.Canonical != "" {
+		canonical := resolveUrl(content.Canonical, finalUrl)
+		if canonical != "" && getHost(canonical) == getHost(page.Uri) {
+			page.Uri = canonical
 		}
 	}
 
-	// Makes sure all bytes are read
-	io.Copy(ioutil.Discard, res.Body)
-
 	// Clean data
+	page.Title = strings.TrimSpace(content.Title)
 	page.Titles = models.CountTfandIdx(tokenizeString(page.Title))
-	page.Words = models.CountTfandIdx(tokenizeString(strings.Join(words, " ")))
+	page.Text = strings.Join(strings.Fields(content.Text), " ")
+	tokens := tokenizeString(page.Text)
+	page.Words = models.CountTfandIdx(tokens)
+	page.Fingerprint = models.SimHash(tokens)
 	page.MaxTf = models.CountMaxTf(page.Words)
 	page.TitleMaxTf = models.CountMaxTf(page.Titles)
-	page.Links = toAbsoluteUrl(page.Links, uri)
+	page.Links = toAbsoluteUrl(content.Links, finalUrl.String())
+	if page.Title == "" {
+		info.reason = "empty title"
+	} else if len(page.Words) == 0 {
+		info.reason = "no text"
+	}
 	return
 }
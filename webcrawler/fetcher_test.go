@@ -0,0 +1,83 @@
+package webcrawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestMetaRefresh(t *testing.T) {
+	refresh := `<html><head><meta http-equiv="Refresh" content="0; URL='%s'"/></head></html>`
+	pages := map[string]string{
+		"/a": fmt.Sprintf(refresh, "b"),
+		"/b": fmt.Sprintf(refresh, "/a"),
+		"/c": `<html><head><meta http-equiv="refresh" content="0; url=/e"></head></html>`,
+		"/e": fmt.Sprintf(refresh, "/d"),
+		"/d": "<html><head><title>d</title></head><body>page d</body></html>",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, found := pages[r.URL.Path]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	// Relative refreshes are followed to the page, with or without a closing slash
+	page, info := politeFetch(server.URL+"/c", nil)
+	if page == nil || page.Uri != server.URL+"/d" || page.Title != "d" {
+		t.Error("Expected page d, got", page, info.reason)
+	}
+
+	// Refresh loops end
+	if page, info = politeFetch(server.URL+"/a", nil); page != nil || info.reason != "too many meta refreshes" {
+		t.Error("Expected the refresh loop to end, got", page, info.reason)
+	}
+}
+
+func TestFeedExtractor(t *testing.T) {
+	uri, _ := url.Parse("http://a.com/feed.xml")
+	feeds := []string{
+		`<rss><channel><title>News</title><item><link>http://a.com/1</link></item></channel></rss>`,
+		`<feed xmlns="http://www.w3.org/2005/Atom"><title>News</title><link href="http://a.com/1"/></feed>`,
+		`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><channel><title>News</title></channel></rdf:RDF>`,
+	}
+	for _, feed := range feeds {
+		content, err := feedExtractor{}.Extract([]byte(feed), "application/xml", uri)
+		if err != nil || content.Title != "News" {
+			t.Error("Expected a feed titled News, got", content, err)
+		}
+	}
+
+	// The charset of the header is used without an XML declaration
+	latin1 := "<rss><channel><title>Caf\xe9</title></channel></rss>"
+	if content, err := (feedExtractor{}).Extract([]byte(latin1), "text/xml; charset=iso-8859-1", uri); err != nil || content.Title != "Café" {
+		t.Error("Expected a feed titled Café, got", content, err)
+	}
+	declared := `<?xml version="1.0" encoding="iso-8859-1"?>` + latin1
+	if content, err := (feedExtractor{}).Extract([]byte(declared), "text/xml; charset=utf-8", uri); err != nil || content.Title != "Café" {
+		t.Error("Expected the declared charset to be used, got", content, err)
+	}
+	utf16 := []byte{0xff, 0xfe}
+	for _, r := range `<?xml version="1.0" encoding="UTF-16"?><feed><title>News</title></feed>` {
+		utf16 = append(utf16, byte(r), 0)
+	}
+	if content, err := (feedExtractor{}).Extract(utf16, "application/xml", uri); err != nil || content.Title != "News" {
+		t.Error("Expected a UTF-16 feed titled News, got", content, err)
+	}
+
+	others := []string{
+		`<urlset><url><loc>http://a.com/1</loc></url></urlset>`,
+		`<?xml version="1.0"?>`,
+	}
+	for _, other := range others {
+		if _, err := (feedExtractor{}).Extract([]byte(other), "text/xml", uri); err == nil {
+			t.Error("Expected other XML to be rejected:", other)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package webcrawler
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Write the pieces of text drawn on a page.
+// Pieces are split into words and lines by the gaps between them.
+func writePdfText(buf *bytes.Buffer, texts []pdf.Text) {
+	for i, t := range texts {
+		if i > 0 {
+			prev := texts[i-1]
+			if math.Abs(t.Y-prev.Y) > prev.FontSize/2 {
+				buf.WriteString("\n")
+			} else if t.X-(prev.X+prev.W) > prev.FontSize*0.15 {
+				buf.WriteString(" ")
+			}
+		}
+		buf.WriteString(t.S)
+	}
+}
+
+// Extracts the text of PDF documents.
+// The title is taken from the document information, or the file name.
+type pdfExtractor struct{}
+
+func (pdfExtractor) Extract(body []byte, contentType string, uri *url.URL) (content *Content, err error) {
+	// The PDF reader panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			content, err = nil, fmt.Errorf("invalid PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	var text bytes.Buffer
+	for i := 1; i <= reader.NumPage(); i++ {
+		writePdfText(&text, reader.Page(i).Content().Text)
+		text.WriteString("\n")
+	}
+
+	content = &Content{Text: text.String()}
+	content.Title = strings.TrimSpace(reader.Trailer().Key("Info").Key("Title").Text())
+	if content.Title == "" {
+		content.Title = titleFromUrl(uri)
+	}
+	return content, nil
+}
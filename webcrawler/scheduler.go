@@ -0,0 +1,191 @@
+package webcrawler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Longest wait after a 429 or 503 response, with or without Retry-After
+const maxBackoff = time.Minute * 2
+
+// Number of times a page is retried after a 429 or 503 response
+const maxRetries = 3
+
+// Politeness state of a single host
+type hostState struct {
+	// Earliest time of the next request
+	next time.Time
+
+	// Number of requests being made
+	active int
+
+	// Wait after the last 429 or 503 response, doubled on every such response
+	backoff time.Duration
+}
+
+// Per-host politeness scheduler.
+// Spaces the requests to each host by at least the delay, or the Crawl-delay
+// of the host's robots.txt if longer, and caps the concurrent requests per host.
+// Thread safe.
+type scheduler struct {
+	lock     sync.Mutex
+	free     *sync.Cond
+	hosts    map[string]*hostState
+	delay    time.Duration
+	maxConns int
+}
+
+func newScheduler(delay time.Duration, maxConns int) *scheduler {
+	s := &scheduler{hosts: make(map[string]*hostState), delay: delay, maxConns: maxConns}
+	s.free = sync.NewCond(&s.lock)
+	return s
+}
+
+// Must be called with the lock held
+func (s *scheduler) getHost(host string) *hostState {
+	h := s.hosts[host]
+	if h == nil {
+		h = &hostState{}
+		s.hosts[host] = h
+	}
+	return h
+}
+
+// Blocks until a request to host may be made.
+// Every call must be followed by a call to release.
+func (s *scheduler) acquire(host string) {
+	delay := s.delay
+	if crawlDelay := getCrawlDelay(host); crawlDelay > delay {
+		delay = crawlDelay
+	}
+
+	s.lock.Lock()
+	h := s.getHost(host)
+	for h.active >= s.maxConns {
+		s.free.Wait()
+	}
+	h.active++
+
+	// Reserve the next slot of the host
+	start := time.Now()
+	if h.next.After(start) {
+		start = h.next
+	}
+	h.next = start.Add(delay)
+	s.lock.Unlock()
+
+	time.Sleep(time.Until(start))
+}
+
+// Marks the end of a request to host
+func (s *scheduler) release(host string) {
+	s.lock.Lock()
+	s.getHost(host).active--
+	s.lock.Unlock()
+	s.free.Broadcast()
+}
+
+// Delays the next request to host after a 429 or 503 response.
+// Waits for retryAfter if given, otherwise backs off exponentially.
+func (s *scheduler) backOff(host string, retryAfter time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h := s.getHost(host)
+
+	if h.backoff == 0 {
+		h.backoff = time.Second
+	} else {
+		h.backoff *= 2
+	}
+	if h.backoff > maxBackoff {
+		h.backoff = maxBackoff
+	}
+
+	wait := h.backoff
+	if retryAfter > 0 {
+		wait = retryAfter
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+
+	if next := time.Now().Add(wait); next.After(h.next) {
+		h.next = next
+	}
+}
+
+// Resets the backoff of host after a successful response
+func (s *scheduler) recover(host string) {
+	s.lock.Lock()
+	s.getHost(host).backoff = 0
+	s.lock.Unlock()
+}
+
+// Servers respond with these statuses when they are overloaded
+func isOverloaded(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// Parse the Retry-After header, given either in seconds or as an HTTP date.
+// Returns 0 if the header is missing or invalid.
+func parseRetryAfter(header string) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// Error of redirects to pages that robots.txt does not allow
+var errRedirectDisallowed = errors.New("redirect " + reasonRobots)
+
+// Transport that makes every request, including each redirect, when the scheduler
+// allows a request to its host, and reports overloaded responses to the scheduler.
+// The request holds its slot until the response body is closed.
+type politeTransport struct {
+	base  http.RoundTripper
+	sched *scheduler
+}
+
+func (t *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	// Redirects may lead to another host, whose robots.txt also gives its Crawl-delay
+	if req.Response != nil && !isAllowedToCrawl(req.URL.String()) {
+		return nil, errRedirectDisallowed
+	}
+
+	t.sched.acquire(host)
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.sched.release(host)
+		return res, err
+	}
+
+	if isOverloaded(res.StatusCode) {
+		t.sched.backOff(host, parseRetryAfter(res.Header.Get("Retry-After")))
+	} else {
+		t.sched.recover(host)
+	}
+	res.Body = &releasingBody{ReadCloser: res.Body, release: func() { t.sched.release(host) }}
+	return res, err
+}
+
+// Response body that releases the slot of its request when closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
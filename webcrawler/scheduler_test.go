@@ -0,0 +1,190 @@
+package webcrawler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Returns a client that makes its requests through a scheduler
+func scheduledClient(sched *scheduler) *http.Client {
+	return &http.Client{Transport: &politeTransport{base: http.DefaultTransport, sched: sched}}
+}
+
+func get(client *http.Client, link string) int {
+	res, err := client.Get(link)
+	if err != nil {
+		return 0
+	}
+	ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return res.StatusCode
+}
+
+// Server that records the time of every request except for robots.txt
+type timedServer struct {
+	*httptest.Server
+	lock  sync.Mutex
+	times []time.Time
+}
+
+func newTimedServer(handler http.HandlerFunc) *timedServer {
+	s := &timedServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		s.lock.Lock()
+		s.times = append(s.times, time.Now())
+		s.lock.Unlock()
+		handler(w, r)
+	}))
+	return s
+}
+
+// Returns the shortest time between two requests
+func (s *timedServer) minGap() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	gap := time.Duration(1<<63 - 1)
+	for i := 1; i < len(s.times); i++ {
+		if d := s.times[i].Sub(s.times[i-1]); d < gap {
+			gap = d
+		}
+	}
+	return gap
+}
+
+func TestSchedulerSpacing(t *testing.T) {
+	delay := time.Millisecond * 100
+	target := newTimedServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer target.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/", http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	// Redirects to another host are spaced like requests made to it directly
+	client := scheduledClient(newScheduler(delay, 2))
+	get(client, target.URL+"/")
+	get(client, redirect.URL+"/")
+	get(client, target.URL+"/")
+	if len(target.times) != 3 {
+		t.Fatal("Expected 3 requests, got", len(target.times))
+	}
+	if gap := target.minGap(); gap < delay-time.Millisecond*10 {
+		t.Error("Expected requests at least", delay, "apart, got", gap)
+	}
+}
+
+func TestSchedulerConnections(t *testing.T) {
+	var lock sync.Mutex
+	active, most := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		active++
+		if active > most {
+			most = active
+		}
+		lock.Unlock()
+
+		time.Sleep(time.Millisecond * 50)
+
+		lock.Lock()
+		active--
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	client := scheduledClient(newScheduler(0, 2))
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get(client, server.URL+"/")
+		}()
+	}
+	wg.Wait()
+
+	if most != 2 {
+		t.Error("Expected at most 2 concurrent requests, got", most)
+	}
+}
+
+func TestSchedulerRetryAfter(t *testing.T) {
+	requests := 0
+	server := newTimedServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+	defer server.Close()
+
+	sched := newScheduler(0, 2)
+	client := scheduledClient(sched)
+	if status := get(client, server.URL+"/"); status != http.StatusTooManyRequests {
+		t.Fatal("Expected HTTP 429, got", status)
+	}
+	if status := get(client, server.URL+"/"); status != http.StatusOK {
+		t.Fatal("Expected HTTP 200, got", status)
+	}
+	if gap := server.minGap(); gap < time.Millisecond*990 {
+		t.Error("Expected the retry to wait for Retry-After, got", gap)
+	}
+	if sched.getHost(server.Listener.Addr().String()).backoff != 0 {
+		t.Error("Expected the backoff to be reset after a successful response")
+	}
+}
+
+func TestBackOff(t *testing.T) {
+	sched := newScheduler(0, 1)
+	expected := []time.Duration{time.Second, time.Second * 2, time.Second * 4}
+	for _, backoff := range expected {
+		sched.backOff("a.com", 0)
+		if h := sched.getHost("a.com"); h.backoff != backoff {
+			t.Error("Expected backoff", backoff, "got", h.backoff)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		sched.backOff("a.com", 0)
+	}
+	if h := sched.getHost("a.com"); h.backoff != maxBackoff || time.Until(h.next) > maxBackoff {
+		t.Error("Expected backoff to be capped, got", h.backoff)
+	}
+
+	// Retry-After is used instead of the backoff, up to the cap
+	sched.backOff("b.com", time.Hour)
+	if wait := time.Until(sched.getHost("b.com").next); wait > maxBackoff || wait < maxBackoff-time.Second {
+		t.Error("Expected Retry-After to be capped, got", wait)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	testcases := []struct {
+		header   string
+		expected time.Duration
+	}{
+		{"3", time.Second * 3},
+		{"0", 0},
+		{"-1", 0},
+		{"", 0},
+		{"soon", 0},
+	}
+	for _, tc := range testcases {
+		if rv := parseRetryAfter(tc.header); rv != tc.expected {
+			t.Errorf("parseRetryAfter(%q) = %v, expected %v", tc.header, rv, tc.expected)
+		}
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if rv := parseRetryAfter(date); rv < time.Second*58 || rv > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, expected about a minute", date, rv)
+	}
+}
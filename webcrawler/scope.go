@@ -0,0 +1,170 @@
+package webcrawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Rules deciding which links are crawled.
+// Only the hosts of the seeds are crawled unless more hosts are allowed.
+// The seed hosts are crawled as one site: a link from any seed host to any other is followed.
+// Host rules match the host and its subdomains, "*" matches every host.
+// If any include rule is given, a link must match one of them.
+// Limits of 0 mean no limit.
+type Scope struct {
+	AllowHosts []string `json:"allowHosts"`
+	DenyHosts  []string `json:"denyHosts"`
+
+	// URL prefixes
+	IncludePrefixes []string `json:"includePrefixes"`
+	ExcludePrefixes []string `json:"excludePrefixes"`
+
+	// Regular expressions matched against the URL
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+
+	// Number of links followed from the seed
+	MaxDepth int `json:"maxDepth"`
+
+	MaxPagesPerHost int `json:"maxPagesPerHost"`
+
+	// Rules for the query parameters of crawled URLs, see canonical.go
+	Query QueryRules `json:"query"`
+
+	include, exclude []*regexp.Regexp
+	seedHosts        map[string]bool
+}
+
+// Returns the scope of the seed hosts only
+func DefaultScope() *Scope {
+	return &Scope{Query: DefaultQueryRules()}
+}
+
+// Load the scope from a JSON file.
+// The scope is compiled.
+func LoadScope(filename string) (*Scope, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := DefaultScope()
+	if err = json.Unmarshal(data, scope); err != nil {
+		return nil, err
+	}
+	return scope, scope.Compile()
+}
+
+// Load seed URLs from a file with one URL per line.
+// Blank lines and lines starting with # are skipped.
+func LoadSeeds(filename string) (seeds []string, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			seeds = append(seeds, line)
+		}
+	}
+	return
+}
+
+// Compile the regular expressions.
+// Must be called after changing the rules.
+func (s *Scope) Compile() (err error) {
+	compile := func(patterns []string) (rv []*regexp.Regexp) {
+		for _, pattern := range patterns {
+			regex, e := regexp.Compile(pattern)
+			if e != nil {
+				err = e
+				continue
+			}
+			rv = append(rv, regex)
+		}
+		return
+	}
+
+	s.include = compile(s.Include)
+	s.exclude = compile(s.Exclude)
+	return
+}
+
+// Add the host of a seed to the crawled hosts
+func (s *Scope) addSeed(seed string) {
+	if s.seedHosts == nil {
+		s.seedHosts = make(map[string]bool)
+	}
+	urlObject, err := url.Parse(seed)
+	if err == nil {
+		s.seedHosts[strings.ToLower(urlObject.Hostname())] = true
+	}
+}
+
+func matchesHost(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*" || host == pattern || strings.HasSuffix(host, "."+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(link string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(link, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(link string, regexes []*regexp.Regexp) bool {
+	for _, regex := range regexes {
+		if regex.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the link may be crawled.
+// Depth and page limits are checked by the crawler.
+func (s *Scope) Allows(link string) bool {
+	urlObject, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(urlObject.Hostname())
+	if matchesHost(host, s.DenyHosts) {
+		return false
+	}
+	if !s.seedHosts[host] && !matchesHost(host, s.AllowHosts) {
+		return false
+	}
+
+	if hasAnyPrefix(link, s.ExcludePrefixes) || matchesAny(link, s.exclude) {
+		return false
+	}
+	if len(s.IncludePrefixes) > 0 || len(s.include) > 0 {
+		return hasAnyPrefix(link, s.IncludePrefixes) || matchesAny(link, s.include)
+	}
+	return true
+}
+
+// Returns true if links found at the given depth may be followed
+func (s *Scope) followsLinksAt(depth int) bool {
+	return s.MaxDepth <= 0 || depth < s.MaxDepth
+}
+
+// Returns true if another page of the host may be fetched
+func (s *Scope) admitsPage(hostPages int) bool {
+	return s.MaxPagesPerHost <= 0 || hostPages < s.MaxPagesPerHost
+}
@@ -0,0 +1,86 @@
+package webcrawler
+
+import "testing"
+
+func TestScopeAllows(t *testing.T) {
+	testcases := []struct {
+		scope    Scope
+		link     string
+		expected bool
+	}{
+		// Only the seed hosts by default
+		{Scope{}, "http://cse.ust.hk/a", true},
+		{Scope{}, "http://seed.com/a", true},
+		{Scope{}, "http://other.com/a", false},
+		{Scope{}, "http://www.cse.ust.hk/a", false},
+		{Scope{}, "not a url%", false},
+
+		// Subdomains and every host
+		{Scope{AllowHosts: []string{"ust.hk"}}, "http://www.cse.ust.hk/a", true},
+		{Scope{AllowHosts: []string{"ust.hk"}}, "http://ust.hk/a", true},
+		{Scope{AllowHosts: []string{"ust.hk"}}, "http://notust.hk/a", false},
+		{Scope{AllowHosts: []string{"*"}}, "http://other.com/a", true},
+		{Scope{AllowHosts: []string{"UST.HK"}}, "http://WWW.UST.HK/a", true},
+
+		// Deny beats allow and the seed hosts
+		{Scope{AllowHosts: []string{"*"}, DenyHosts: []string{"other.com"}}, "http://www.other.com/a", false},
+		{Scope{AllowHosts: []string{"ust.hk"}, DenyHosts: []string{"www.ust.hk"}}, "http://www.ust.hk/a", false},
+		{Scope{DenyHosts: []string{"*"}}, "http://cse.ust.hk/a", false},
+
+		// Exclude beats include
+		{Scope{IncludePrefixes: []string{"http://cse.ust.hk/ug/"}, ExcludePrefixes: []string{"http://cse.ust.hk/ug/old/"}}, "http://cse.ust.hk/ug/old/a", false},
+		{Scope{IncludePrefixes: []string{"http://cse.ust.hk/ug/"}, Exclude: []string{`\.pdf$`}}, "http://cse.ust.hk/ug/a.pdf", false},
+		{Scope{Include: []string{"/ug/"}, Exclude: []string{"/old/"}}, "http://cse.ust.hk/ug/old/a", false},
+
+		// Include only
+		{Scope{IncludePrefixes: []string{"http://cse.ust.hk/ug/"}}, "http://cse.ust.hk/ug/a", true},
+		{Scope{IncludePrefixes: []string{"http://cse.ust.hk/ug/"}}, "http://cse.ust.hk/pg/a", false},
+		{Scope{Include: []string{"/(ug|pg)/"}}, "http://cse.ust.hk/pg/a", true},
+		{Scope{Include: []string{"/(ug|pg)/"}}, "http://cse.ust.hk/staff/a", false},
+		{Scope{IncludePrefixes: []string{"http://cse.ust.hk/ug/"}, Include: []string{"/pg/"}}, "http://cse.ust.hk/pg/a", true},
+		{Scope{ExcludePrefixes: []string{"http://cse.ust.hk/ug/"}}, "http://cse.ust.hk/pg/a", true},
+	}
+
+	for _, tc := range testcases {
+		scope := tc.scope
+		if err := scope.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		scope.addSeed("http://cse.ust.hk/")
+		scope.addSeed("http://SEED.com/")
+		if rv := scope.Allows(tc.link); rv != tc.expected {
+			t.Errorf("Allows(%q) with %+v = %v, expected %v", tc.link, tc.scope, rv, tc.expected)
+		}
+	}
+}
+
+func TestScopeLimits(t *testing.T) {
+	testcases := []struct {
+		scope               Scope
+		depth, hostPages    int
+		follows, admitsPage bool
+	}{
+		{Scope{}, 100, 1000, true, true},
+		{Scope{MaxDepth: 2}, 1, 0, true, true},
+		{Scope{MaxDepth: 2}, 2, 0, false, true},
+		{Scope{MaxPagesPerHost: 3}, 0, 2, true, true},
+		{Scope{MaxPagesPerHost: 3}, 0, 3, true, false},
+		{Scope{MaxDepth: -1, MaxPagesPerHost: -1}, 5, 5, true, true},
+	}
+
+	for _, tc := range testcases {
+		if rv := tc.scope.followsLinksAt(tc.depth); rv != tc.follows {
+			t.Errorf("followsLinksAt(%d) with %+v = %v, expected %v", tc.depth, tc.scope, rv, tc.follows)
+		}
+		if rv := tc.scope.admitsPage(tc.hostPages); rv != tc.admitsPage {
+			t.Errorf("admitsPage(%d) with %+v = %v, expected %v", tc.hostPages, tc.scope, rv, tc.admitsPage)
+		}
+	}
+}
+
+func TestCompileScope(t *testing.T) {
+	scope := Scope{Include: []string{"("}}
+	if scope.Compile() == nil {
+		t.Error("Expected an invalid regular expression to be an error")
+	}
+}
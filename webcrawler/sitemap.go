@@ -0,0 +1,181 @@
+package webcrawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rsmohamad/comp4321/database"
+	"github.com/rsmohamad/comp4321/models"
+	"golang.org/x/net/html/charset"
+)
+
+// Sitemap index files are followed this many levels deep
+const maxSitemapDepth = 2
+
+// Most URLs taken from the sitemaps of one host
+const maxSitemapUrls = 50000
+
+// Entry of a sitemap, or of a sitemap index for <sitemap> entries
+type sitemapEntry struct {
+	Loc      string `xml:"loc"`
+	Lastmod  string `xml:"lastmod"`
+	Priority string `xml:"priority"`
+}
+
+// A <urlset> or a <sitemapindex> document
+type sitemapDocument struct {
+	XMLName  xml.Name
+	Urls     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+// Parse the W3C datetime of a lastmod, which may be only a date.
+// Returns 0 if it cannot be parsed.
+func parseLastmod(lastmod string) int64 {
+	lastmod = strings.TrimSpace(lastmod)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if tm, err := time.Parse(layout, lastmod); err == nil {
+			return tm.Unix()
+		}
+	}
+	return 0
+}
+
+// Parse the priority of a sitemap entry, which defaults to 0.5
+func parsePriority(priority string) float64 {
+	if value, err := strconv.ParseFloat(strings.TrimSpace(priority), 64); err == nil && value >= 0 && value <= 1 {
+		return value
+	}
+	return database.DefaultCrawlPriority
+}
+
+// Fetch and parse a sitemap, which may be gzipped.
+// Returns nil and the reason in info if it cannot be fetched.
+func fetchSitemap(link string) (document *sitemapDocument, info fetchInfo) {
+	if _, err := url.Parse(link); err != nil {
+		info.reason = "invalid url"
+		return nil, info
+	}
+	if !isAllowedToCrawl(link) {
+		info.reason = reasonRobots
+		return nil, info
+	}
+
+	start := time.Now()
+	res, err := fetchClient.Get(link)
+	if err != nil {
+		info.reason = "request failed"
+		return nil, info
+	}
+	defer res.Body.Close()
+	info.status = res.StatusCode
+	info.contentType = res.Header.Get("Content-Type")
+	if res.StatusCode != http.StatusOK {
+		info.reason = fmt.Sprintf("HTTP %d", res.StatusCode)
+		return nil, info
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	info.latency = time.Since(start)
+	info.bytes = len(body)
+	if err != nil {
+		info.reason = "request failed"
+		return nil, info
+	}
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			info.reason = "invalid sitemap"
+			return nil, info
+		}
+		body, _ = ioutil.ReadAll(io.LimitReader(reader, maxBodySize))
+	}
+
+	document = &sitemapDocument{}
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = charset.NewReaderLabel
+	if decoder.Decode(document) != nil {
+		info.reason = "invalid sitemap"
+		return nil, info
+	}
+	return document, info
+}
+
+// Returns the entries of the sitemaps of a website.
+// Sitemaps are taken from the Sitemap lines of robots.txt, or /sitemap.xml if there are none.
+// Every sitemap requested is recorded in crawlLog.
+func getSitemapEntries(seed *url.URL, crawlLog *CrawlLog) (entries []sitemapEntry) {
+	queue := getRobots(seed).Sitemaps
+	if len(queue) == 0 {
+		queue = []string{fmt.Sprintf("%s://%s/sitemap.xml", seed.Scheme, seed.Host)}
+	}
+
+	visited := make(map[string]bool)
+	for depth := 0; depth <= maxSitemapDepth && len(queue) > 0; depth++ {
+		next := make([]string, 0)
+		for _, link := range queue {
+			if visited[link] || len(entries) >= maxSitemapUrls {
+				continue
+			}
+			visited[link] = true
+
+			document, info := fetchSitemap(link)
+			result := fetchResult{fetchInfo: info, uri: link}
+			if document == nil {
+				if info.reason == reasonRobots {
+					crawlLog.record(result, outcomeSkipped)
+				} else {
+					crawlLog.record(result, outcomeFailed)
+				}
+				continue
+			}
+			crawlLog.record(result, outcomeSitemap)
+			entries = append(entries, document.Urls...)
+			for _, sitemap := range document.Sitemaps {
+				next = append(next, strings.TrimSpace(sitemap.Loc))
+			}
+		}
+		queue = next
+	}
+
+	if len(entries) > maxSitemapUrls {
+		entries = entries[:maxSitemapUrls]
+	}
+	return
+}
+
+// Add the pages in the sitemaps of the seed's website to the queue.
+// Pages are ordered by their sitemap priority and last modification.
+// Returns the number of pages added.
+func ingestSitemaps(seed string, index *database.Indexer, scope *Scope, crawlLog *CrawlLog, recrawl bool) int {
+	seedUrl, err := url.Parse(seed)
+	if err != nil {
+		return 0
+	}
+
+	queued := make([]models.QueuedUrl, 0)
+	for _, entry := range getSitemapEntries(seedUrl, crawlLog) {
+		link := canonicalise(entry.Loc)
+		if link == "" || !scope.Allows(link) || (!recrawl && index.ContainsUrl(link)) {
+			continue
+		}
+
+		// Pages in sitemaps are taken as linked from the seed
+		queued = append(queued, models.QueuedUrl{
+			Url:      link,
+			Depth:    1,
+			Priority: parsePriority(entry.Priority),
+			Lastmod:  parseLastmod(entry.Lastmod),
+		})
+	}
+	return len(index.Enqueue(queued))
+}
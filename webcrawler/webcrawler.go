@@ -4,8 +4,13 @@ import (
 	"fmt"
 	"github.com/rsmohamad/comp4321/database"
 	"github.com/rsmohamad/comp4321/models"
+	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/temoto/robotstxt"
 )
@@ -32,14 +37,10 @@ func fetchRobotsTxt(urlObject *url.URL) (rv *robotstxt.RobotsData) {
 	return
 }
 
-// Checks if the url is crawlable.
+// Returns the robots.txt of the url's website.
 // Will fetch robots.txt if not previously fetched.
 // Thread safe.
-func isAllowedToCrawl(link string) bool {
-	// Use url object to process URLs
-	urlObject, _ := url.Parse(link)
-	var robots *robotstxt.RobotsData
-
+func getRobots(urlObject *url.URL) (robots *robotstxt.RobotsData) {
 	// Fetch a website's robots.txt if it's not already fetched
 	res, found := robotMap.Load(urlObject.Host)
 	if !found {
@@ -54,9 +55,19 @@ func isAllowedToCrawl(link string) bool {
 		}
 		robots = res.(*robotstxt.RobotsData)
 	}
+	return
+}
+
+// Checks if the url is crawlable.
+// Will fetch robots.txt if not previously fetched.
+// Thread safe.
+func isAllowedToCrawl(link string) bool {
+	// Use url object to process URLs
+	urlObject, _ := url.Parse(link)
+	robots := getRobots(urlObject)
 
 	// Check with robots.txt
-	if !robots.TestAgent(urlObject.Path, "Agent") {
+	if !robots.TestAgent(urlObject.RequestURI(), "Agent") {
 		fmt.Println(urlObject.String() + " is not allowed; skipped!")
 		return false
 	}
@@ -64,51 +75,242 @@ func isAllowedToCrawl(link string) bool {
 	return true
 }
 
+// Returns the Crawl-delay of the host's robots.txt, or 0 if there is none.
+// The robots.txt must have been fetched by isAllowedToCrawl.
+func getCrawlDelay(host string) time.Duration {
+	res, found := robotMap.Load(host)
+	if !found || res == nil {
+		return 0
+	}
+	return res.(*robotstxt.RobotsData).FindGroup("Agent").CrawlDelay
+}
+
+// Most meta refreshes followed from a page
+const maxRefreshes = 5
+
+// Fetch the page when the scheduler allows a request to its host.
+// Retries pages that are refused because the server is overloaded.
+// Meta refreshes are followed like links, each when the scheduler allows it.
+func politeFetch(link string, prev *models.Document) (page *models.Document, info fetchInfo) {
+	fetched, retries := 0, 0
+	for refreshes := 0; ; refreshes++ {
+		page, info = retryFetch(link, prev)
+		info.bytes += fetched
+		info.retries += retries
+		if info.refresh == "" {
+			return
+		}
+		if refreshes == maxRefreshes {
+			info.reason = "too many meta refreshes"
+			return nil, info
+		}
+		if !isAllowedToCrawl(info.refresh) {
+			info.reason = reasonRobots
+			return nil, info
+		}
+		link, prev, fetched, retries = info.refresh, nil, info.bytes, info.retries
+	}
+}
+
+// Fetch the page when the scheduler allows a request to its host, see politeFetch.
+// The number of retries is returned in info.retries.
+func retryFetch(link string, prev *models.Document) (page *models.Document, info fetchInfo) {
+	for attempt := 0; ; attempt++ {
+		page, info = fetchPage(link, prev)
+		info.retries = attempt
+
+		if !isOverloaded(info.status) || attempt == maxRetries {
+			return
+		}
+	}
+}
+
+// Result of fetching a single URL.
+// For pages that are not modified or gone, page holds the stored document.
+// Reason tells why no page was returned.
+type fetchResult struct {
+	fetchInfo
+	uri   string
+	depth int
+	page  *models.Document
+
+	// URL of the page an indexed page is a near duplicate of
+	duplicateOf string
+}
+
+// Pages with these statuses no longer exist and are removed from the index.
+func isGone(status int) bool {
+	return status == http.StatusNotFound || status == http.StatusGone
+}
+
+// Reason of the URLs that robots.txt does not allow
+const reasonRobots = "disallowed by robots.txt"
+
+// Number of fetched pages between saves of the index and the frontier
+const checkpointInterval = 50
+
 // Concurrent routine for fetching a page.
 // Feeds the page to results channel if fetch is successful.
-// Feeds nil if fetch is unsuccessful.
-func concurrentFetch(url string, results *chan *models.Document) {
+// Feeds a nil page and the reason if fetch is unsuccessful.
+// If prev is not nil, the page is only fetched if it was modified since prev.
+func concurrentFetch(url string, prev *models.Document, depth int, results *chan fetchResult) {
+	result := fetchResult{uri: url, depth: depth}
 	if !isAllowedToCrawl(url) {
-		*results <- nil
+		result.reason = reasonRobots
+		*results <- result
 		return
 	}
-	<-throttle
-	page := Fetch(url)
-	if page != nil && len(page.Words) > 0 && page.Title != "" {
-		*results <- page
-	} else {
-		*results <- nil
+
+	page, info := politeFetch(url, prev)
+	result.fetchInfo = info
+	if prev != nil && (info.status == http.StatusNotModified || isGone(info.status)) {
+		result.page = prev
+		result.reason = ""
+	} else if info.reason == "" {
+		result.page = page
 	}
+	*results <- result
 }
 
-func Crawl(uri string, num int, index *database.Indexer, restrictHost, aggressive bool) (pages []*models.Document) {
-	var activeCounter int
+// Returns the lower case host name of the link
+func getHost(link string) string {
+	urlObject, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(urlObject.Hostname())
+}
+
+// Crawl starting from the seeds until num pages are fetched.
+// Seeds are crawled breadth first together, each at depth 0.
+// Already indexed pages are skipped unless recrawl is set, in which case
+// they are requested conditionally and only re-indexed if they changed.
+// Indexed pages that are gone on re-crawl are deleted from the index.
+// Links are followed if the scope allows them, see scope.go.
+//
+// The frontier is kept in the index, see database/frontier.go.
+// With resume, the crawl continues from the frontier of the previous crawl with its seeds
+// and the given ones, otherwise the frontier is cleared first. num counts the pages of this run only.
+// An interrupt stops the crawl once the pages being fetched are in, so it can be resumed.
+// Every dequeued URL is recorded in crawlLog, which may be nil, see crawllog.go.
+func Crawl(seeds []string, num int, index *database.Indexer, scope *Scope, crawlLog *CrawlLog, aggressive, recrawl, resume bool) (pages []*models.Document) {
+	var activeCounter, unchanged int
 	var updateWg sync.WaitGroup
-	visited := make(map[string]bool)
-	results := make(chan *models.Document)
-	queue := make([]string, 0)
+	results := make(chan fetchResult)
+	stopping := false
+
+	// Fetched pages that are indexed but not yet flushed
+	pending := make([]fetchResult, 0)
+
+	// Number of pages fetched or being fetched from each host
+	hostPages := make(map[string]int)
 
 	initClients(aggressive)
 
-	// Sanitize url
-	u, _ := url.Parse(uri)
-	newUrl := "http://" + u.Host + u.Path
-	fmt.Println(newUrl)
-	queue = append(queue, newUrl)
-	visited[newUrl] = true
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	queryRules = scope.Query
+
+	// Indexes of older versions are re-keyed here, since the database package does not know the canonical form
+	if rekeyed, removed := index.CanonicaliseUrls(canonicalise); rekeyed+removed > 0 {
+		fmt.Printf("Canonicalised %d urls, removed %d duplicate pages\n", rekeyed, removed)
+	}
+
+	// A resumed crawl keeps the seeds of the previous one in scope
+	if resume {
+		seeds = append(index.GetSeeds(), seeds...)
+	}
+
+	// Sanitize urls
+	startUrls := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, seed := range seeds {
+		newUrl := canonicalise(seed)
+		if newUrl == "" {
+			fmt.Println("Invalid seed: " + seed)
+			continue
+		}
+		if seen[newUrl] {
+			continue
+		}
+		seen[newUrl] = true
+		fmt.Println(newUrl)
+		scope.addSeed(newUrl)
+		startUrls = append(startUrls, newUrl)
+	}
+
+	if resume {
+		fmt.Printf("Resuming crawl, requeued %d in-flight and skipped pages\n", index.RequeueUnfinished())
+		// A redirect counts toward the host of the URL that was requested only
+		index.ForEachCrawlState(func(link string, state models.CrawlState) {
+			if state.Status == models.Fetched && state.RedirectedFrom == "" {
+				hostPages[getHost(link)]++
+			}
+		})
+	} else {
+		index.ClearFrontier()
+	}
+	index.EnqueueSeeds(startUrls)
+
+	// The frontier of a resumed crawl already has the pages in the sitemaps
+	if !resume {
+		sitemapHosts := make(map[string]bool)
+		for _, seed := range startUrls {
+			if host := getHost(seed); !sitemapHosts[host] {
+				sitemapHosts[host] = true
+				fmt.Printf("Queued %d pages from the sitemaps of %s\n", ingestSitemaps(seed, index, scope, crawlLog, recrawl), host)
+			}
+		}
+	}
+
+	// Save the inverted index, then mark the pages in it as fetched
+	checkpoint := func() {
+		updateWg.Wait()
+		index.FlushInverted()
+		for _, result := range pending {
+			index.SetCrawlState(result.uri, models.Fetched, "")
 
-	for len(pages) < num {
+			// Redirected pages are visited under both URLs, and taken out of the queue under the target
+			if result.page.Uri != result.uri {
+				index.SetRedirectTarget(result.page.Uri, result.uri)
+			}
+		}
+		pending = pending[:0]
+	}
+
+	for len(pages)+unchanged < num {
 		// Create goroutines as needed
-		needed := num - len(pages) - activeCounter
-		for ; len(queue) > 0 && needed > 0; needed-- {
-			activeCounter++
-			go concurrentFetch(queue[0], &results)
-			queue = queue[1:]
+		needed := num - len(pages) - unchanged - activeCounter
+		dequeued := 0
+		if needed > 0 && !stopping {
+			links := index.DequeueUrls(needed)
+			dequeued = len(links)
+			for _, link := range links {
+				host := getHost(link)
+				if !scope.admitsPage(hostPages[host]) {
+					skipped := fetchResult{uri: link}
+					skipped.reason = "page limit of host reached"
+					crawlLog.record(skipped, outcomeSkipped)
+					index.SetCrawlState(link, models.Skipped, skipped.reason)
+					continue
+				}
+				hostPages[host]++
+
+				var prev *models.Document
+				if recrawl {
+					prev = index.GetDocument(link)
+				}
+				state, _ := index.GetCrawlState(link)
+				activeCounter++
+				go concurrentFetch(link, prev, state.Depth, &results)
+			}
 		}
 
 		// End prematurely if no links are available
 		if activeCounter <= 0 {
-			if len(queue) == 0 {
+			if dequeued == 0 || stopping {
 				break
 			} else {
 				continue
@@ -116,43 +318,82 @@ func Crawl(uri string, num int, index *database.Indexer, restrictHost, aggressiv
 		}
 
 		// Retrieve one page from results channel
-		page := <-results
+		var result fetchResult
+		select {
+		case result = <-results:
+		case <-interrupt:
+			// A second interrupt kills the process
+			signal.Stop(interrupt)
+			fmt.Printf("Interrupted, waiting for %d pages; resume with -resume\n", activeCounter)
+			stopping = true
+			continue
+		}
+		page := result.page
 		activeCounter--
 		if page == nil {
+			hostPages[getHost(result.uri)]--
+			if result.status == http.StatusOK || result.reason == reasonRobots {
+				crawlLog.record(result, outcomeSkipped)
+			} else {
+				crawlLog.record(result, outcomeFailed)
+			}
+			index.SetCrawlState(result.uri, models.Failed, result.reason)
 			continue
 		}
 
-		visited[page.Uri] = true
-		pages = append(pages, page)
-		fmt.Printf("Fetched page #%d out of %d : %s\n", len(pages), num, page.Uri)
-		updateWg.Add(1)
-		go func(i int, doc *models.Document) {
-			index.UpdateOrAddPage(doc)
-			//fmt.Printf("Indexed page #%d out of %d : %s\n", i, num, page.Uri)
-			updateWg.Done()
-		}(len(pages), page)
+		if isGone(result.status) {
+			hostPages[getHost(result.uri)]--
+			updateWg.Add(1)
+			go func(uri string) {
+				index.DeletePage(uri)
+				updateWg.Done()
+			}(page.Uri)
+			crawlLog.record(result, outcomeDeleted)
+			index.SetCrawlState(result.uri, models.Failed, fmt.Sprintf("HTTP %d", result.status))
+			fmt.Printf("Deleted: %s\n", page.Uri)
+			continue
+		} else if result.status == http.StatusNotModified {
+			unchanged++
+			crawlLog.record(result, outcomeUnchanged)
+			index.SetCrawlState(result.uri, models.Fetched, "")
+			fmt.Printf("Not modified: %s\n", page.Uri)
+		} else {
+			pages = append(pages, page)
+			fmt.Printf("Fetched page #%d out of %d : %s\n", len(pages)+unchanged, num, page.Uri)
+			updateWg.Add(1)
+			go func(i int, doc *models.Document, result fetchResult) {
+				// Near duplicates are only known once the page is indexed
+				result.duplicateOf = index.UpdateOrAddPage(doc)
+				crawlLog.record(result, outcomeIndexed)
+				//fmt.Printf("Indexed page #%d out of %d : %s\n", i, num, page.Uri)
+				updateWg.Done()
+			}(len(pages), page, result)
+
+			pending = append(pending, result)
+		}
 
 		// Put unvisited links into queue
+		links := make([]string, 0)
 		for _, link := range page.Links {
-			// Crawl only the starting domain
-			if restrictHost {
-				urlParse, _ := url.Parse(link)
-				if urlParse.Host != u.Host {
-					continue
-				}
+			if !scope.followsLinksAt(result.depth) {
+				break
 			}
 
-			// skip if the link is already visited or indexed
-			if visited[link] || index.ContainsUrl(link) {
+			// skip if the link is out of scope, or indexed when not re-crawling
+			if !scope.Allows(link) || (!recrawl && index.ContainsUrl(link)) {
 				continue
 			}
 
-			queue = append(queue, link)
-			visited[link] = true
+			links = append(links, link)
+		}
+		// Links that were already seen are skipped by the frontier
+		index.EnqueueUrls(links, result.depth+1)
+
+		if len(pending) >= checkpointInterval {
+			checkpoint()
 		}
 	}
 
-	updateWg.Wait()
-	index.FlushInverted()
+	checkpoint()
 	return pages
 }